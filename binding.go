@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/tobiashort/cfmt-go"
+)
+
+const (
+	firefoxUserAgent = "Mozilla/5.0 (X11; Linux x86_64; rv:128.0) Gecko/20100101 Firefox/128.0"
+	chromeUserAgent  = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Safari/537.36"
+	spoofedClientIP  = "203.0.113.7"
+)
+
+var bindingProxyURL *url.URL
+
+type bindingVariation struct {
+	name      string
+	attribute string
+	client    func(req Request) *http.Client
+	modify    func(req Request) Request
+}
+
+func configureBinding(args Args) error {
+	if args.BindingProxy == "" {
+		return nil
+	}
+	u, err := url.Parse(args.BindingProxy)
+	if err != nil {
+		return fmt.Errorf("invalid --binding-proxy: %w", err)
+	}
+	bindingProxyURL = u
+	return nil
+}
+
+func bindingVariations() []bindingVariation {
+	variations := []bindingVariation{
+		{
+			name:      "different User-Agent",
+			attribute: "User-Agent",
+			modify: func(req Request) Request {
+				userAgent := firefoxUserAgent
+				if strings.Contains(req.Header.Get("User-Agent"), "Firefox") {
+					userAgent = chromeUserAgent
+				}
+				req.Header.Set("User-Agent", userAgent)
+				return req
+			},
+		},
+		{
+			name:      "client IP headers (X-Forwarded-For, X-Real-IP)",
+			attribute: "client IP headers",
+			modify: func(req Request) Request {
+				req.Header.Set("X-Forwarded-For", spoofedClientIP)
+				req.Header.Set("X-Real-IP", spoofedClientIP)
+				return req
+			},
+		},
+	}
+	egress := func(proxy *url.URL) func(req Request) *http.Client {
+		return func(req Request) *http.Client {
+			client := newHTTPClient(req)
+			client.Transport.(*http.Transport).Proxy = http.ProxyURL(proxy)
+			return client
+		}
+	}
+	// Requests sent with curl take the egress from the curl options instead.
+	egressCurl := func(options ...string) func(req Request) Request {
+		return func(req Request) Request {
+			if len(req.CurlOptions) > 0 {
+				req.CurlOptions = append(req.CurlOptions, options...)
+			}
+			return req
+		}
+	}
+	switch {
+	case bindingProxyURL != nil:
+		variations = append(variations, bindingVariation{name: "egress via " + bindingProxyURL.Redacted(), attribute: "egress IP", client: egress(bindingProxyURL), modify: egressCurl("--proxy", bindingProxyURL.String())})
+	case proxyURL != nil:
+		variations = append(variations, bindingVariation{name: "direct egress without --proxy", attribute: "egress IP", client: egress(nil), modify: egressCurl("--noproxy", "*")})
+	}
+	return variations
+}
+
+func checkConnection(ctx context.Context, run *Run, client *http.Client, req Request) (ProbeResult, bool) {
+	reused := false
+	trace := &httptrace.ClientTrace{GotConn: func(info httptrace.GotConnInfo) { reused = info.Reused }}
+	result := checkAccessWith(httptrace.WithClientTrace(ctx, trace), run, client, req)
+	return result, reused
+}
+
+func performSessionBindingTest(ctx context.Context, dir string, curlCommand string, req Request) *Run {
+	cfmt.Printf("Performing #yB{'%s'} test...\n", sessionBindingTest)
+	startTime = time.Now()
+	run := startFindingSession(dir, sessionBindingTest, curlCommand, req)
+	defer run.Finish(ctx)
+
+	bound := make([]string, 0)
+	invalidating := make([]string, 0)
+	untested := make([]string, 0)
+
+	cfmt.Fprintf(console, "Checking access on a fresh connection...\n")
+	client := newHTTPClient(req)
+	defer client.CloseIdleConnections()
+	fresh, _ := checkConnection(ctx, run, client, req)
+	if fresh.Verdict != verdictAuthenticated {
+		run.Conclude(findingInconclusive, "the unchanged request is not authenticated (%s)", fresh.Verdict)
+		return run
+	}
+	cfmt.Fprintf(console, "Checking access on the reused connection...\n")
+	reused, wasReused := checkConnection(ctx, run, client, req)
+	switch {
+	case !wasReused:
+		run.Note("Reused connection: not tested, the server did not keep the connection open")
+		untested = append(untested, "the TLS connection")
+	case reused.Verdict == verdictAuthenticated:
+		run.Note("Fresh and reused connections are both accepted")
+	case reused.Verdict == verdictLoggedOut:
+		run.Note("Reused connection: %s while a fresh connection is accepted", reused.Verdict)
+		bound = append(bound, "the TLS connection")
+	default:
+		run.Note("Reused connection: %s", inconclusiveReason(reused))
+		untested = append(untested, "the TLS connection ("+inconclusiveReason(reused)+")")
+	}
+
+	for i, variation := range bindingVariations() {
+		if ctx.Err() != nil {
+			return run
+		}
+		variant := req.Clone()
+		if variation.modify != nil {
+			variant = variation.modify(variant)
+		}
+		variantClient := newHTTPClient(variant)
+		if variation.client != nil {
+			variantClient = variation.client(variant)
+		}
+		cfmt.Fprintf(console, "Checking access with %s...\n", variation.name)
+		result := checkAccessWith(ctx, run, variantClient, variant)
+		variantClient.CloseIdleConnections()
+		cfmt.Fprintf(console, "Checking access with the unchanged request...\n")
+		after := checkAccess(ctx, run, req)
+		switch result.Verdict {
+		case verdictLoggedOut:
+			bound = append(bound, variation.attribute)
+		case verdictInconclusive:
+			untested = append(untested, variation.attribute+" ("+inconclusiveReason(result)+")")
+		}
+		run.Note("%s: %s, unchanged request afterwards: %s", strings.ToUpper(variation.name[:1])+variation.name[1:], result.Verdict, after.Verdict)
+		if after.Verdict == verdictAuthenticated {
+			continue
+		}
+		invalidating = append(invalidating, variation.attribute+" change")
+		if loginRequest.URL == "" {
+			for _, rest := range bindingVariations()[i+1:] {
+				untested = append(untested, rest.attribute)
+			}
+			run.Note("Session was invalidated and no --login is given, stopping")
+			break
+		}
+		fresh, err := relogin(ctx, req)
+		if err != nil {
+			run.Conclude(findingInconclusive, "session was invalidated by the %s change and logging in again failed: %s", variation.attribute, err.Error())
+			return run
+		}
+		req = fresh
+		run.Note("Logged in again")
+	}
+	if ctx.Err() != nil {
+		return run
+	}
+
+	summary := "session is not bound to any of the tested attributes"
+	if len(bound) > 0 {
+		summary = "session is bound to " + strings.Join(bound, ", ")
+	}
+	if len(invalidating) > 0 {
+		summary += "; the session is invalidated by " + strings.Join(invalidating, ", ")
+	}
+	if len(untested) > 0 {
+		summary += "; not tested: " + strings.Join(untested, ", ")
+	}
+	run.Conclude(findingInfo, "%s", summary)
+	return run
+}
+
+func inconclusiveReason(result ProbeResult) string {
+	if result.Error != "" {
+		return result.Error
+	}
+	return fmt.Sprintf("inconclusive at %f similarity", result.Similarity)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+var (
+	proxyURL  *url.URL
+	tlsConfig = &tls.Config{}
+)
+
+func configureTransport(args Args) error {
+	if args.Proxy != "" {
+		u, err := url.Parse(args.Proxy)
+		if err != nil {
+			return fmt.Errorf("invalid proxy: %w", err)
+		}
+		switch u.Scheme {
+		case "http", "https", "socks5", "socks5h":
+		default:
+			return fmt.Errorf("unsupported proxy scheme: %s", u.Scheme)
+		}
+		proxyURL = u
+	}
+	if args.CaCert != "" {
+		pem, err := os.ReadFile(args.CaCert)
+		if err != nil {
+			return err
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in %s", args.CaCert)
+		}
+		tlsConfig.RootCAs = pool
+		caCertArg = args.CaCert
+	}
+	tlsConfig.InsecureSkipVerify = args.Insecure
+	if args.ClientCert != "" || args.ClientKey != "" {
+		if args.ClientCert == "" || args.ClientKey == "" {
+			return fmt.Errorf("client certificate and client key must be given together")
+		}
+		cert, err := tls.LoadX509KeyPair(args.ClientCert, args.ClientKey)
+		if err != nil {
+			return err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+		clientCertArg, clientKeyArg = args.ClientCert, args.ClientKey
+	}
+	return nil
+}
+
+func newHTTPClient(req Request) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if proxyURL != nil {
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+	transport.TLSClientConfig = tlsConfig.Clone()
+	if req.Insecure {
+		transport.TLSClientConfig.InsecureSkipVerify = true
+	}
+	client := &http.Client{Transport: transport, Timeout: 60 * time.Second}
+	if !req.FollowRedirects {
+		client.CheckRedirect = func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		}
+	}
+	return client
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tobiashort/cfmt-go"
+	"github.com/tobiashort/choose-go"
+	. "github.com/tobiashort/utils-go/must"
+)
+
+type CombinedResult struct {
+	Test              string   `json:"test"`
+	Started           string   `json:"started"`
+	HardTimeout       string   `json:"hard_timeout"`
+	InactivityTimeout string   `json:"inactivity_timeout"`
+	Sessions          []string `json:"sessions"`
+}
+
+func sameSession(a Request, b Request) bool {
+	return a.Header.Get("Cookie") == b.Header.Get("Cookie") && a.Header.Get("Authorization") == b.Header.Get("Authorization")
+}
+
+func newSessionRequest(ctx context.Context, label string, req Request) (string, Request, error) {
+	if loginRequest.URL != "" {
+		fresh, err := relogin(ctx, req)
+		if err != nil {
+			return "", Request{}, err
+		}
+		return fresh.CurlCommand(), fresh, nil
+	}
+	cfmt.Printf("Please provide the request for the #yB{'%s'} session. It must belong to a separate login.\n", label)
+	source, ok := choose.One("Please choose where to load the request from", requestSources)
+	if !ok {
+		return "", Request{}, fmt.Errorf("no request for the %s session", label)
+	}
+	reference := referenceResponse
+	curlCommand, fresh := requestFromSource(source)
+	referenceResponse = reference
+	if sameSession(req, fresh) {
+		return "", Request{}, fmt.Errorf("the %s session uses the same cookies and credentials as the hard timeout session", label)
+	}
+	return curlCommand, fresh, nil
+}
+
+func mergeInactivity(idle []*Run, hard *Run) string {
+	var lower, upper *ProbeResult
+	for _, run := range idle {
+		for i, result := range run.state.Probes {
+			switch result.Verdict {
+			case verdictAuthenticated:
+				if lower == nil || result.Waited > lower.Waited {
+					lower = &run.state.Probes[i]
+				}
+			case verdictLoggedOut:
+				if upper == nil || result.Waited < upper.Waited {
+					upper = &run.state.Probes[i]
+				}
+			}
+		}
+	}
+	hardAuthenticated, hardLoggedOut := logoutWindow(hard.state.Probes)
+	switch {
+	case lower == nil && upper == nil:
+		return fmt.Sprintf("%s: no conclusive probe", inactivityTimeoutTest)
+	case upper == nil:
+		return fmt.Sprintf("%s: no logout observed, still authenticated after %v of inactivity", inactivityTimeoutTest, lower.Waited)
+	case hardLoggedOut != nil && hardAuthenticated != nil && upper.Elapsed >= hardAuthenticated.Elapsed:
+		return fmt.Sprintf("%s: not observed before the hard timeout, the logout after %v of inactivity happened %v after the start", inactivityTimeoutTest, upper.Waited, upper.Elapsed)
+	case lower == nil:
+		return fmt.Sprintf("%s: already logged out after %v of inactivity", inactivityTimeoutTest, upper.Waited)
+	case lower.Waited >= upper.Waited:
+		return fmt.Sprintf("%s: inconsistent, authenticated after %v but logged out after %v of inactivity", inactivityTimeoutTest, lower.Waited, upper.Waited)
+	default:
+		return fmt.Sprintf("%s: logged out between %v and %v of inactivity", inactivityTimeoutTest, lower.Waited, upper.Waited)
+	}
+}
+
+func formatCombinedReport(result CombinedResult, runs []*Run) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# wylmo combined report\n\n")
+	fmt.Fprintf(&b, "- Test: %s\n", result.Test)
+	fmt.Fprintf(&b, "- Started: %s\n", result.Started)
+	fmt.Fprintf(&b, "- %s\n", result.HardTimeout)
+	fmt.Fprintf(&b, "- %s\n\n", result.InactivityTimeout)
+	fmt.Fprintf(&b, "| Session | Status | Probes | Verdict |\n")
+	fmt.Fprintf(&b, "|---|---|---|---|\n")
+	for _, run := range runs {
+		fmt.Fprintf(&b, "| %s | %s | %d | %s |\n", run.label, run.state.Status, len(run.state.Probes), run.state.Verdict)
+	}
+	return b.String()
+}
+
+func performCombinedTest(ctx context.Context, dir string, curlCommand string, req Request) {
+	cfmt.Printf("Performing #yB{'%s'} test with #yB{%d} idle sessions...\n", combinedTimeoutTest, idleSessionsArg)
+	type session struct {
+		label       string
+		curlCommand string
+		req         Request
+	}
+	sessions := []session{{"hard", curlCommand, req}}
+	for k := 1; k <= idleSessionsArg; k++ {
+		label := fmt.Sprintf("idle-%d", k)
+		idleCurlCommand, idleReq, err := newSessionRequest(ctx, label, req)
+		if err != nil {
+			cfmt.Printf("#r{%s}\n", err.Error())
+			return
+		}
+		sessions = append(sessions, session{label, idleCurlCommand, idleReq})
+	}
+	interval := hardTimeoutInterval()
+	cfmt.Printf("Hard timeout interval is set to #yB{'%v'}\n", interval)
+	cfmt.Printf("Inactivity schedule is #yB{'%v'}\n", schedule)
+	for k := 1; k <= idleSessionsArg; k++ {
+		cfmt.Printf("Projected test time of #yB{'idle-%d'} is #yB{%s}\n", k, schedule.Projection(k-1, idleSessionsArg))
+	}
+	startTime = time.Now()
+	idleCtx, cancelIdle := context.WithCancel(ctx)
+	defer cancelIdle()
+	var (
+		mu       sync.Mutex
+		upper    time.Duration
+		wg       sync.WaitGroup
+		runs     = make([]*Run, len(sessions))
+		idleRuns = make([]*Run, 0, idleSessionsArg)
+	)
+	for i, s := range sessions {
+		sessionDir := filepath.Join(dir, s.label)
+		Must(os.Mkdir(sessionDir, 0755))
+		typeOfTest := inactivityTimeoutTest
+		if i == 0 {
+			typeOfTest = hardTimeoutTest
+		}
+		run, jar := startSession(sessionDir, typeOfTest, s.curlCommand, s.req, referenceResponse)
+		run.label = s.label
+		run.stopOnLogout = true
+		if i == 0 {
+			startStream(ctx, run, s.req)
+		}
+		runs[i] = run
+		if i > 0 {
+			idleRuns = append(idleRuns, run)
+			run.proceed = func(next time.Duration) bool {
+				mu.Lock()
+				defer mu.Unlock()
+				return upper == 0 || next < upper
+			}
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer jar.Close()
+			defer run.Finish(ctx)
+			if i == 0 {
+				hardTimeoutLoop(ctx, run, s.req, jar, interval)
+				if run.loggedOut {
+					cancelIdle()
+				}
+				return
+			}
+			inactivityTimeoutLoop(idleCtx, run, s.req, jar, schedule.Waits(i-1, idleSessionsArg))
+			if _, loggedOut := logoutWindow(run.state.Probes); loggedOut != nil {
+				mu.Lock()
+				if upper == 0 || loggedOut.Waited < upper {
+					upper = loggedOut.Waited
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	result := CombinedResult{
+		Test:              combinedTimeoutTest,
+		Started:           startTime.Format(time.RFC3339),
+		HardTimeout:       runs[0].state.Verdict,
+		InactivityTimeout: mergeInactivity(idleRuns, runs[0]),
+	}
+	for _, s := range sessions {
+		result.Sessions = append(result.Sessions, s.label)
+	}
+	writeJSON(filepath.Join(dir, "combined.json"), result)
+	Must(os.WriteFile(filepath.Join(dir, "report.md"), []byte(formatCombinedReport(result, runs)), 0644))
+	cfmt.Fprintf(console, "Verdict: #yB{%s}\n", result.HardTimeout)
+	cfmt.Fprintf(console, "Verdict: #yB{%s}\n", result.InactivityTimeout)
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/tobiashort/cfmt-go"
+	. "github.com/tobiashort/utils-go/must"
+)
+
+type CookieJar struct {
+	names     []string
+	values    map[string]string
+	rotations int
+	checked   int
+	logFile   *os.File
+}
+
+type StaleCookieResult struct {
+	Time       time.Time `json:"time"`
+	Status     int       `json:"status,omitempty"`
+	Similarity float64   `json:"similarity"`
+	Verdict    string    `json:"verdict"`
+	Finding    string    `json:"finding"`
+}
+
+func newCookieJar(req Request, logPath string) *CookieJar {
+	jar := &CookieJar{
+		names:   make([]string, 0),
+		values:  make(map[string]string),
+		logFile: Must2(os.OpenFile(logPath, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0644)),
+	}
+	for _, pair := range strings.Split(req.Header.Get("Cookie"), ";") {
+		name, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			continue
+		}
+		jar.set(name, value)
+	}
+	return jar
+}
+
+func (jar *CookieJar) set(name, value string) {
+	if _, ok := jar.values[name]; !ok {
+		jar.names = append(jar.names, name)
+	}
+	jar.values[name] = value
+}
+
+func (jar *CookieJar) remove(name string) {
+	delete(jar.values, name)
+	for i, n := range jar.names {
+		if n == name {
+			jar.names = append(jar.names[:i], jar.names[i+1:]...)
+			break
+		}
+	}
+}
+
+func (jar *CookieJar) Apply(req Request) Request {
+	if !cookieJarArg {
+		return req
+	}
+	req = req.Clone()
+	pairs := make([]string, 0, len(jar.names))
+	for _, name := range jar.names {
+		pairs = append(pairs, name+"="+jar.values[name])
+	}
+	if len(pairs) == 0 {
+		req.Header.Del("Cookie")
+	} else {
+		req.Header.Set("Cookie", strings.Join(pairs, "; "))
+	}
+	return req
+}
+
+func (jar *CookieJar) Update(resp Response, now time.Time) {
+	cookies := (&http.Response{Header: resp.Header}).Cookies()
+	for _, cookie := range cookies {
+		addCookieSecret(cookie.Name, cookie.Value)
+		old, known := jar.values[cookie.Name]
+		expired := cookie.MaxAge < 0 || (!cookie.Expires.IsZero() && cookie.Expires.Before(now))
+		var event string
+		switch {
+		case expired && known:
+			jar.remove(cookie.Name)
+			event = fmt.Sprintf("%s removed (was %s)", cookie.Name, old)
+		case expired:
+			continue
+		case !known:
+			jar.set(cookie.Name, cookie.Value)
+			event = fmt.Sprintf("%s set to %s", cookie.Name, cookie.Value)
+		case old != cookie.Value:
+			jar.set(cookie.Name, cookie.Value)
+			event = fmt.Sprintf("%s rotated from %s to %s", cookie.Name, old, cookie.Value)
+			jar.rotations++
+		default:
+			continue
+		}
+		event = redact(event)
+		cfmt.Fprintf(console, "%v #bB{cookie} %s\n", formatTime(now), event)
+		Must2(fmt.Fprintf(jar.logFile, "%v %s\n", formatTime(now), event))
+	}
+}
+
+// Rotated reports whether a known cookie changed its value since the last
+// call, so that stale cookies are replayed once per rotation.
+func (jar *CookieJar) Rotated() bool {
+	rotated := jar.rotations > jar.checked
+	jar.checked = jar.rotations
+	return rotated
+}
+
+func (jar *CookieJar) Close() {
+	jar.logFile.Close()
+}
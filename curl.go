@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	. "github.com/tobiashort/utils-go/must"
+)
+
+// curlValueOptions lists the curl options wylmo does not handle itself that
+// take a value, so that the value is passed through together with them.
+var curlValueOptions = map[string]bool{
+	"-o": true, "--output": true, "-w": true, "--write-out": true, "-m": true, "--max-time": true,
+	"--connect-timeout": true, "-x": true, "--proxy": true, "-U": true, "--proxy-user": true,
+	"--cacert": true, "--capath": true, "-E": true, "--cert": true, "--key": true, "--cert-type": true,
+	"--key-type": true, "--pass": true, "--resolve": true, "--connect-to": true, "--interface": true,
+	"--retry": true, "--retry-delay": true, "--retry-max-time": true, "-r": true, "--range": true,
+	"-T": true, "--upload-file": true, "-F": true, "--form": true, "--form-string": true,
+	"-c": true, "--cookie-jar": true, "-D": true, "--dump-header": true, "--limit-rate": true,
+	"-y": true, "--speed-time": true, "-Y": true, "--speed-limit": true, "--max-redirs": true,
+	"--max-filesize": true, "--proxy-header": true, "--noproxy": true, "--socks5": true,
+	"--socks5-hostname": true, "--preproxy": true, "--tls-max": true, "--ciphers": true,
+	"--dns-servers": true, "--local-port": true, "--unix-socket": true, "--abstract-unix-socket": true,
+	"--oauth2-bearer": true, "--aws-sigv4": true, "--json": true, "-K": true, "--config": true,
+	"--trace": true, "--trace-ascii": true, "--stderr": true, "--expect100-timeout": true,
+	"--keepalive-time": true, "--pinnedpubkey": true, "--proto": true, "--proto-redir": true,
+	"-Q": true, "--quote": true, "-z": true, "--time-cond": true, "--doh-url": true,
+	"--netrc-file": true, "--service-name": true, "--request-target": true, "--url-query": true,
+	"--variable": true, "--proxy-cacert": true, "--proxy-cert": true, "--proxy-key": true,
+}
+
+var (
+	caCertArg     string
+	clientCertArg string
+	clientKeyArg  string
+)
+
+// sendCurl executes requests with curl options wylmo does not handle itself.
+// The body is what curl writes to stdout, like wylmo always compared it, and
+// the status and headers are read from a header dump.
+func sendCurl(ctx context.Context, req Request) (Response, error) {
+	dump := Must2(os.CreateTemp("", "wylmo-headers-"))
+	dump.Close()
+	defer os.Remove(dump.Name())
+	args := []string{"-sS", "--max-time", "60", "-D", dump.Name()}
+	switch {
+	case req.Method == http.MethodHead:
+		args = append(args, "-I")
+	case req.Method != http.MethodGet || req.Body != "":
+		args = append(args, "-X", req.Method)
+	}
+	for name, values := range req.Header {
+		for _, value := range values {
+			args = append(args, "-H", name+": "+value)
+		}
+	}
+	if req.Body != "" {
+		args = append(args, "--data-binary", "@-")
+	}
+	if req.FollowRedirects {
+		args = append(args, "-L")
+	}
+	if req.Insecure || tlsConfig.InsecureSkipVerify {
+		args = append(args, "-k")
+	}
+	if proxyURL != nil {
+		args = append(args, "--proxy", proxyURL.String())
+	}
+	if caCertArg != "" {
+		args = append(args, "--cacert", caCertArg)
+	}
+	if clientCertArg != "" {
+		args = append(args, "--cert", clientCertArg, "--key", clientKeyArg)
+	}
+	args = append(args, req.CurlOptions...)
+	args = append(args, "--url", req.URL)
+	cmd := exec.CommandContext(ctx, "curl", args...)
+	cmd.Stdin = strings.NewReader(req.Body)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return Response{}, fmt.Errorf("%w: %s", err, message)
+		}
+		return Response{}, err
+	}
+	resp, err := parseHeaderDump(Must2(os.ReadFile(dump.Name())), req.URL)
+	if err != nil {
+		return Response{}, err
+	}
+	resp.Body = stdout.String()
+	return resp, nil
+}
+
+// parseHeaderDump reads the last response of a curl header dump and turns
+// the redirects before it into the redirect chain.
+func parseHeaderDump(dump []byte, from string) (Response, error) {
+	resp := Response{}
+	reader := textproto.NewReader(bufio.NewReader(bytes.NewReader(dump)))
+	for {
+		line, err := reader.ReadLine()
+		if err != nil {
+			break
+		}
+		if line == "" {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 || !strings.HasPrefix(fields[0], "HTTP/") {
+			return Response{}, fmt.Errorf("invalid status line in curl header dump: %s", line)
+		}
+		code, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return Response{}, fmt.Errorf("invalid status line in curl header dump: %s", line)
+		}
+		if location := resp.Header.Get("Location"); resp.StatusCode >= 300 && resp.StatusCode < 400 && location != "" {
+			to := location
+			if base, err := url.Parse(from); err == nil {
+				if target, err := base.Parse(location); err == nil {
+					to = target.String()
+				}
+			}
+			resp.Redirects = append(resp.Redirects, Redirect{Status: resp.StatusCode, From: from, To: to})
+			from = to
+		}
+		header, _ := reader.ReadMIMEHeader()
+		resp.Status = line
+		resp.StatusCode = code
+		resp.Header = http.Header(header)
+	}
+	if resp.Status == "" {
+		return Response{}, fmt.Errorf("curl returned no response headers")
+	}
+	return resp, nil
+}
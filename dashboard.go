@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/tobiashort/ansi-go"
+	. "github.com/tobiashort/utils-go/must"
+
+	"golang.org/x/term"
+)
+
+const maxDashboardEvents = 200
+
+var sparkChars = []rune("▁▂▃▄▅▆▇█")
+
+type Dashboard struct {
+	typeOfTest string
+	phase      string
+	interval   time.Duration
+	next       time.Time
+	remaining  time.Duration
+	paused     bool
+	results    []ProbeResult
+	events     []string
+	partial    string
+	keys       chan string
+	oldState   *term.State
+	cancel     context.CancelFunc
+}
+
+func newDashboard(typeOfTest string, cancel context.CancelFunc) *Dashboard {
+	d := &Dashboard{
+		typeOfTest: typeOfTest,
+		cancel:     cancel,
+		phase:      "Starting",
+		results:    make([]ProbeResult, 0),
+		events:     make([]string, 0),
+		keys:       make(chan string, 8),
+	}
+	d.oldState = Must2(term.MakeRaw(int(os.Stdin.Fd())))
+	fmt.Print(ansi.CursorHide, ansi.EraseEntireScreen)
+	go func() {
+		buf := make([]byte, 3)
+		for {
+			n, err := os.Stdin.Read(buf)
+			if err != nil {
+				return
+			}
+			d.keys <- string(buf[:n])
+		}
+	}()
+	return d
+}
+
+func (d *Dashboard) Write(p []byte) (int, error) {
+	d.partial += string(p)
+	for {
+		line, rest, found := strings.Cut(d.partial, "\n")
+		if !found {
+			break
+		}
+		d.events = append(d.events, line)
+		d.partial = rest
+	}
+	if len(d.events) > maxDashboardEvents {
+		d.events = d.events[len(d.events)-maxDashboardEvents:]
+	}
+	d.render()
+	return len(p), nil
+}
+
+func (d *Dashboard) Record(result ProbeResult) {
+	d.results = append(d.results, result)
+	d.render()
+}
+
+// Wait returns the time actually waited, which differs from the interval when
+// the probe is triggered early or the countdown was paused.
+func (d *Dashboard) Wait(ctx context.Context, interval time.Duration) (time.Duration, bool) {
+	start := time.Now()
+	d.phase = "Waiting"
+	d.interval = interval
+	d.next = time.Now().Add(interval)
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		d.render()
+		var due <-chan time.Time
+		if !d.paused {
+			due = time.After(time.Until(d.next))
+		}
+		select {
+		case <-ctx.Done():
+			d.phase = "Stopping"
+			d.render()
+			return time.Since(start).Round(time.Millisecond), false
+		case <-ticker.C:
+		case <-due:
+			d.phase = "Probing"
+			d.render()
+			return time.Since(start).Round(time.Millisecond), true
+		case key := <-d.keys:
+			switch key {
+			case "n":
+				d.paused = false
+				d.phase = "Probing"
+				d.render()
+				return time.Since(start).Round(time.Millisecond), true
+			case "p":
+				if !d.paused {
+					d.paused = true
+					d.remaining = time.Until(d.next)
+				}
+			case "r":
+				if d.paused {
+					d.paused = false
+					d.next = time.Now().Add(d.remaining)
+				}
+			case "q", ansi.InputCtrlC:
+				// Raw mode swallows SIGINT, so stop the test like the signal handler does.
+				d.cancel()
+			}
+		}
+	}
+}
+
+func sparkline(results []ProbeResult, width int) string {
+	if len(results) > width {
+		results = results[len(results)-width:]
+	}
+	var b strings.Builder
+	for _, result := range results {
+		index := int(math.Round(result.Similarity * float64(len(sparkChars)-1)))
+		index = max(min(index, len(sparkChars)-1), 0)
+		b.WriteString(colorByVerdict(result.Verdict, string(sparkChars[index])))
+	}
+	return b.String()
+}
+
+func (d *Dashboard) render() {
+	width, height, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil {
+		return
+	}
+	now := time.Now()
+	phase := d.phase
+	countdown := "-"
+	if d.phase == "Waiting" {
+		remaining := time.Until(d.next)
+		if d.paused {
+			phase = "Paused"
+			remaining = d.remaining
+		}
+		countdown = fmt.Sprintf("%v (interval %v)", max(remaining, 0).Round(time.Second), d.interval)
+	}
+	lastVerdict := "-"
+	if len(d.results) > 0 {
+		last := d.results[len(d.results)-1]
+		if last.Error != "" {
+			lastVerdict = colorByVerdict(last.Verdict, last.Verdict+" ("+last.Error+")")
+		} else {
+			lastVerdict = colorByVerdict(last.Verdict, fmt.Sprintf("%s (%f similarity)", last.Verdict, last.Similarity))
+		}
+	}
+	lines := []string{
+		ansi.DecorReversed + padLine(" wylmo - "+d.typeOfTest, width) + ansi.DecorReset,
+		" Phase:        " + phase,
+		" Elapsed:      " + now.Sub(startTime).Round(time.Second).String(),
+		" Next probe:   " + countdown,
+		fmt.Sprintf(" Probes:       %d", len(d.results)),
+		" Last verdict: " + lastVerdict,
+		" Similarity:   " + sparkline(d.results, max(width-16, 1)),
+		"",
+		" Recent events:",
+	}
+	eventLines := max(height-len(lines)-1, 0)
+	events := d.events
+	if len(events) > eventLines {
+		events = events[len(events)-eventLines:]
+	}
+	for _, event := range events {
+		lines = append(lines, " "+event)
+	}
+	var b strings.Builder
+	b.WriteString(ansi.CursorMoveToHomePosition)
+	for _, line := range lines {
+		b.WriteString(truncateLine(line, width))
+		b.WriteString(ansi.DecorReset + ansi.EraseFromCursorToEndOfLine + "\r\n")
+	}
+	b.WriteString(ansi.EraseFromCursorToEndOfScreen)
+	b.WriteString(ansi.CursorMoveTo(height, 1))
+	b.WriteString(ansi.DecorReversed + padLine(" n: probe now  p: pause  r: resume  q: quit", width) + ansi.DecorReset)
+	fmt.Print(b.String())
+}
+
+func (d *Dashboard) Close() {
+	term.Restore(int(os.Stdin.Fd()), d.oldState)
+	fmt.Print(ansi.CursorShow, ansi.EraseEntireScreen, ansi.CursorMoveToHomePosition)
+	console = os.Stdout
+	for _, event := range d.events {
+		fmt.Println(event)
+	}
+}
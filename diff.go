@@ -0,0 +1,298 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/tobiashort/ansi-go"
+	"github.com/tobiashort/cfmt-go"
+	"github.com/tobiashort/choose-go"
+	"github.com/tobiashort/clap-go"
+	. "github.com/tobiashort/utils-go/must"
+
+	"golang.org/x/term"
+)
+
+const maxDiffEdits = 1000
+
+type DiffArgs struct {
+	RunDir string `clap:"positional,mandatory,description='Directory of the test run.'"`
+	Probe  int    `clap:"positional,description='Index of the probe to compare with the reference (default: last probe).'"`
+}
+
+type diffOp struct {
+	kind byte
+	text string
+}
+
+func diffLines(a, b []string) []diffOp {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	ops := make([]diffOp, 0, len(a)+len(b))
+	for _, line := range a[:prefix] {
+		ops = append(ops, diffOp{' ', line})
+	}
+	ops = append(ops, myers(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, line := range a[len(a)-suffix:] {
+		ops = append(ops, diffOp{' ', line})
+	}
+	return ops
+}
+
+func myers(a, b []string) []diffOp {
+	n, m := len(a), len(b)
+	max := n + m
+	offset := max + 1
+	v := make([]int, 2*max+3)
+	trace := make([][]int, 0)
+	for d := 0; d <= max; d++ {
+		if d > maxDiffEdits {
+			ops := make([]diffOp, 0, n+m)
+			for _, line := range a {
+				ops = append(ops, diffOp{'-', line})
+			}
+			for _, line := range b {
+				ops = append(ops, diffOp{'+', line})
+			}
+			return ops
+		}
+		trace = append(trace, slices.Clone(v[offset-d:offset+d+1]))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				return backtrack(a, b, trace)
+			}
+		}
+	}
+	return nil
+}
+
+func backtrack(a, b []string, trace [][]int) []diffOp {
+	ops := make([]diffOp, 0)
+	x, y := len(a), len(b)
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		at := func(k int) int { return v[k+d] }
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && at(k-1) < at(k+1)) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := 0
+		if d > 0 {
+			prevX = at(prevK)
+		}
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			ops = append(ops, diffOp{' ', a[x-1]})
+			x--
+			y--
+		}
+		if d > 0 {
+			if x == prevX {
+				ops = append(ops, diffOp{'+', b[y-1]})
+			} else {
+				ops = append(ops, diffOp{'-', a[x-1]})
+			}
+		}
+		x, y = prevX, prevY
+	}
+	slices.Reverse(ops)
+	return ops
+}
+
+func unifiedDiff(a, b []string, context int) []string {
+	ops := diffLines(a, b)
+	lines := make([]string, 0)
+	for start := 0; start < len(ops); {
+		for start < len(ops) && ops[start].kind == ' ' {
+			start++
+		}
+		if start == len(ops) {
+			break
+		}
+		from := max(start-context, 0)
+		end := start
+		for i := start; i < len(ops); i++ {
+			if ops[i].kind != ' ' {
+				end = i + 1
+			} else if i-end >= 2*context {
+				break
+			}
+		}
+		to := min(end+context, len(ops))
+		aLine, bLine := 1, 1
+		for _, op := range ops[:from] {
+			if op.kind != '+' {
+				aLine++
+			}
+			if op.kind != '-' {
+				bLine++
+			}
+		}
+		aCount, bCount := 0, 0
+		hunk := make([]string, 0, to-from)
+		for _, op := range ops[from:to] {
+			if op.kind != '+' {
+				aCount++
+			}
+			if op.kind != '-' {
+				bCount++
+			}
+			hunk = append(hunk, string(op.kind)+op.text)
+		}
+		lines = append(lines, fmt.Sprintf("@@ -%d,%d +%d,%d @@", aLine, aCount, bLine, bCount))
+		lines = append(lines, hunk...)
+		start = to
+	}
+	return lines
+}
+
+func colorDiffLine(line string) string {
+	switch {
+	case !term.IsTerminal(int(os.Stdout.Fd())):
+		return line
+	case strings.HasPrefix(line, "@@"):
+		return ansi.DecorCyan + line + ansi.DecorReset
+	case strings.HasPrefix(line, "+"):
+		return ansi.DecorGreen + line + ansi.DecorReset
+	case strings.HasPrefix(line, "-"):
+		return ansi.DecorRed + line + ansi.DecorReset
+	default:
+		return line
+	}
+}
+
+func splitLines(s string) []string {
+	return strings.Split(strings.ReplaceAll(s, "\r\n", "\n"), "\n")
+}
+
+func readEvidence(dir string, name string) (string, error) {
+	headers, err := os.ReadFile(filepath.Join(dir, name+".headers"))
+	if err != nil {
+		return "", err
+	}
+	body, err := os.ReadFile(filepath.Join(dir, name+".body"))
+	if err != nil {
+		return "", err
+	}
+	statusLine, _, _ := strings.Cut(string(headers), "\r\n")
+	return statusLine + "\n" + string(body), nil
+}
+
+func probeDiffPage(dir string, reference string, manifest []ManifestEntry, index int) (string, []string) {
+	entry := manifest[index]
+	name := probeName(entry.Index)
+	title := fmt.Sprintf("Probe %d/%d: %s +%s %s", entry.Index, len(manifest), name, entry.Elapsed, entry.Verdict)
+	if entry.Error != "" {
+		return title, []string{entry.Error}
+	}
+	probe, err := readEvidence(dir, name)
+	if err != nil {
+		return title, []string{err.Error()}
+	}
+	lines := []string{
+		colorDiffLine("--- reference"),
+		colorDiffLine("+++ " + name),
+	}
+	hunks := unifiedDiff(splitLines(reference), splitLines(probe), 3)
+	if len(hunks) == 0 {
+		lines = append(lines, "(no differences)")
+	}
+	for _, line := range hunks {
+		lines = append(lines, colorDiffLine(line))
+	}
+	return title, lines
+}
+
+func browseProbeDiffs(dir string, index int) error {
+	reference, err := readEvidence(dir, "reference")
+	if err != nil {
+		return err
+	}
+	manifest, err := readManifest(dir)
+	if err != nil {
+		return err
+	}
+	if len(manifest) == 0 {
+		return fmt.Errorf("no probes in %s", dir)
+	}
+	if index < 0 {
+		index = len(manifest) - 1
+	}
+	if index >= len(manifest) {
+		return fmt.Errorf("probe %d does not exist, %s has %d probes", index+1, dir, len(manifest))
+	}
+	runPager(len(manifest), index, func(index int) (string, []string) {
+		return probeDiffPage(dir, reference, manifest, index)
+	})
+	return nil
+}
+
+// chooseRunDir lets the user pick one session of a combined, role or trial
+// run, whose probes are stored in subdirectories.
+func chooseRunDir(dir string) (string, error) {
+	if _, err := os.Stat(filepath.Join(dir, "manifest.json")); err == nil {
+		return dir, nil
+	}
+	runs := make([]string, 0)
+	err := filepath.WalkDir(dir, func(p string, d os.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return err
+		}
+		if _, err := os.Stat(filepath.Join(p, "manifest.json")); err == nil {
+			runs = append(runs, Must2(filepath.Rel(dir, p)))
+		}
+		return nil
+	})
+	switch {
+	case err != nil:
+		return "", err
+	case len(runs) == 0:
+		return "", fmt.Errorf("%s contains no test run", dir)
+	case len(runs) == 1:
+		return filepath.Join(dir, runs[0]), nil
+	}
+	run, ok := choose.One("Please choose the session to compare", runs)
+	if !ok {
+		return "", fmt.Errorf("no session chosen")
+	}
+	return filepath.Join(dir, run), nil
+}
+
+func diffCommand() {
+	args := DiffArgs{}
+	clap.Prog("wylmo diff")
+	clap.Description("Show the difference between the reference and a stored probe response.")
+	clap.Parse(&args)
+	dir, err := chooseRunDir(args.RunDir)
+	if err == nil {
+		err = browseProbeDiffs(dir, args.Probe-1)
+	}
+	if err != nil {
+		cfmt.Printf("#r{%s}\n", err.Error())
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/tobiashort/cfmt-go"
+	. "github.com/tobiashort/utils-go/must"
+)
+
+const mainEndpoint = "main"
+
+type EndpointConfig struct {
+	Name             string  `json:"name"`
+	Request          string  `json:"request"`
+	Threshold        float64 `json:"threshold,omitempty"`
+	LoggedOutStatus  []int   `json:"logged_out_status,omitempty"`
+	LoggedOutPattern string  `json:"logged_out_pattern,omitempty"`
+	req              Request
+	pattern          *regexp.Regexp
+}
+
+type Endpoint struct {
+	config EndpointConfig
+	req    Request
+	run    *Run
+}
+
+type EndpointResult struct {
+	Name          string `json:"name"`
+	Verdict       string `json:"verdict"`
+	Inconsistency string `json:"inconsistency,omitempty"`
+	Chain         string `json:"chain,omitempty"`
+}
+
+var endpointConfigs = make([]EndpointConfig, 0)
+
+func configureEndpoints(args Args) error {
+	if args.Endpoints == "" {
+		return nil
+	}
+	data, err := os.ReadFile(args.Endpoints)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, &endpointConfigs); err != nil {
+		return fmt.Errorf("%s: %w", args.Endpoints, err)
+	}
+	names := map[string]bool{mainEndpoint: true}
+	for i := range endpointConfigs {
+		config := &endpointConfigs[i]
+		if config.Name == "" || names[config.Name] || strings.ContainsAny(config.Name, `/\`) {
+			return fmt.Errorf("%s: endpoint %d needs a unique name without slashes other than %q", args.Endpoints, i+1, mainEndpoint)
+		}
+		names[config.Name] = true
+		file := config.Request
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(filepath.Dir(args.Endpoints), file)
+		}
+		config.req, err = readCommandFile(file)
+		if err != nil {
+			return fmt.Errorf("endpoint %s: %w", config.Name, err)
+		}
+		addRequestSecrets(config.req)
+		if config.LoggedOutPattern != "" {
+			config.pattern, err = regexp.Compile(config.LoggedOutPattern)
+			if err != nil {
+				return fmt.Errorf("endpoint %s: invalid logged_out_pattern: %w", config.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (config EndpointConfig) verdict(similarity float64, resp Response) string {
+	switch {
+	case slices.Contains(config.LoggedOutStatus, resp.StatusCode):
+		return verdictLoggedOut
+	case config.pattern != nil && config.pattern.MatchString(resp.Body):
+		return verdictLoggedOut
+	case similarity >= cmp.Or(config.Threshold, thresholdArg):
+		return verdictAuthenticated
+	default:
+		return verdictLoggedOut
+	}
+}
+
+func startEndpoints(ctx context.Context, run *Run, req Request) {
+	for _, config := range endpointConfigs {
+		endpointReq := withSession(config.req, req)
+		reference, err := sendRequest(ctx, endpointReq)
+		if err != nil {
+			cfmt.Fprintf(console, "#r{Endpoint '%s' is skipped, its reference request failed: %s}\n", config.Name, redact(err.Error()))
+			continue
+		}
+		dir := filepath.Join(run.dir, "endpoint-"+config.Name)
+		Must(os.Mkdir(dir, 0755))
+		writeRequest(dir, endpointReq.CurlCommand(), endpointReq)
+		writeResponse(dir, "reference", reference)
+		endpointRun := newRun(dir, run.state.Test)
+		endpointRun.label = config.Name
+		endpointRun.reference = reference
+		run.endpoints = append(run.endpoints, &Endpoint{config: config, req: endpointReq, run: endpointRun})
+		cfmt.Fprintf(console, "Endpoint #yB{'%s'} is probed with the same session (reference %s)\n", config.Name, reference.Status)
+	}
+}
+
+func (endpoint *Endpoint) probe(ctx context.Context, jar *CookieJar, waited time.Duration) {
+	req := jar.Apply(endpoint.req)
+	resp, err := sendRequestWith(ctx, newProbeClient(req), req)
+	if ctx.Err() != nil {
+		return
+	}
+	now := time.Now()
+	result := ProbeResult{Time: now, Elapsed: now.Sub(startTime), Waited: waited, Verdict: verdictInconclusive}
+	if err != nil {
+		result.Error = redact(err.Error())
+	} else {
+		jar.Update(resp, now)
+		result.Status = resp.StatusCode
+		result.Redirects = redactRedirects(resp.Redirects)
+		result.Similarity = similarityTo(endpoint.run.reference, resp)
+		result.Verdict = endpoint.config.verdict(result.Similarity, resp)
+	}
+	endpoint.run.Record(result, resp)
+}
+
+func firstLogout(probes []ProbeResult) int {
+	return slices.IndexFunc(probes, func(result ProbeResult) bool { return result.Verdict == verdictLoggedOut })
+}
+
+// compareEndpoints lines up the probes of all endpoints by scheduled point
+// and reports endpoints that are still authenticated after another endpoint
+// observed the logout.
+func compareEndpoints(run *Run) []EndpointResult {
+	names := []string{mainEndpoint}
+	series := [][]ProbeResult{run.state.Probes}
+	verdicts := []string{run.state.Verdict}
+	chains := []string{""}
+	for _, endpoint := range run.endpoints {
+		names = append(names, endpoint.config.Name)
+		series = append(series, endpoint.run.state.Probes)
+		verdicts = append(verdicts, endpoint.run.state.Verdict)
+		chains = append(chains, endpoint.run.chain)
+	}
+	results := make([]EndpointResult, 0, len(names))
+	for i, probes := range series {
+		result := EndpointResult{Name: names[i], Verdict: verdicts[i], Chain: chains[i]}
+		first, firstName := -1, ""
+		for j, other := range series {
+			if index := firstLogout(other); j != i && index >= 0 && (first < 0 || index < first) {
+				first, firstName = index, names[j]
+			}
+		}
+		if first >= 0 {
+			last := -1
+			for k := first; k < len(probes); k++ {
+				if probes[k].Verdict == verdictAuthenticated {
+					last = k
+				}
+			}
+			if last >= 0 {
+				result.Inconsistency = fmt.Sprintf("still authenticated at %v after %s reported the logout at %v",
+					measure(run.state.Test, probes[last]), firstName, measure(run.state.Test, series[slices.Index(names, firstName)][first]))
+			}
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+func (run *Run) finishEndpoints(ctx context.Context) {
+	if len(run.endpoints) == 0 {
+		return
+	}
+	for _, endpoint := range run.endpoints {
+		endpoint.run.Finish(ctx)
+	}
+	run.state.Endpoints = compareEndpoints(run)
+}
+
+// verifyEndpointChains checks that the hash chain of every endpoint ends in
+// the head recorded in the state of the run, so that the endpoint evidence
+// cannot be left out or swapped.
+func verifyEndpointChains(state RunState, read func(name string) ([]byte, error)) error {
+	for _, endpoint := range state.Endpoints {
+		if endpoint.Chain == "" {
+			continue
+		}
+		dir := "endpoint-" + endpoint.Name + "/"
+		data, err := read(dir + "manifest.json")
+		if err != nil {
+			return err
+		}
+		manifest := make([]ManifestEntry, 0)
+		if err := json.Unmarshal(data, &manifest); err != nil {
+			return fmt.Errorf("%smanifest.json: %w", dir, err)
+		}
+		head := ""
+		if len(manifest) > 0 {
+			head = manifest[len(manifest)-1].Chain
+		} else if reference, err := read(dir + "reference.body"); err == nil {
+			head = sha256Hex(reference)
+		}
+		if head != endpoint.Chain {
+			return fmt.Errorf("endpoint %s: hash chain does not end in the head recorded by the run", endpoint.Name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "github.com/tobiashort/utils-go/must"
+)
+
+type ManifestEntry struct {
+	Index         int        `json:"index"`
+	Time          string     `json:"time"`
+	Elapsed       string     `json:"elapsed"`
+	Waited        string     `json:"waited,omitempty"`
+	Status        int        `json:"status,omitempty"`
+	Similarity    float64    `json:"similarity"`
+	Verdict       string     `json:"verdict"`
+	Error         string     `json:"error,omitempty"`
+	Redirects     []Redirect `json:"redirects,omitempty"`
+	Body          string     `json:"body"`
+	Headers       string     `json:"headers"`
+	Meta          string     `json:"meta"`
+	SHA256        string     `json:"sha256"`
+	HeadersSHA256 string     `json:"headers_sha256"`
+	Chain         string     `json:"chain"`
+}
+
+func probeName(index int) string {
+	return fmt.Sprintf("probe-%04d", index)
+}
+
+func formatHeaders(resp Response) string {
+	if resp.Status == "" {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString(resp.Status + "\r\n")
+	Must(resp.Header.Write(&b))
+	return b.String()
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func writeResponse(dir string, name string, resp Response) (string, string) {
+	body := redact(resp.Body)
+	headers := redact(formatHeaders(resp))
+	Must(os.WriteFile(filepath.Join(dir, name+".body"), []byte(body), 0644))
+	Must(os.WriteFile(filepath.Join(dir, name+".headers"), []byte(headers), 0644))
+	return sha256Hex([]byte(body)), sha256Hex([]byte(headers))
+}
+
+func chainHash(prev string, entry ManifestEntry) string {
+	entry.Chain = ""
+	return sha256Hex(append([]byte(prev), Must2(json.Marshal(entry))...))
+}
+
+func writeProbeEvidence(dir string, result ProbeResult, resp Response, prevChain string) ManifestEntry {
+	name := probeName(result.Index)
+	entry := ManifestEntry{
+		Index:      result.Index,
+		Time:       result.Time.Format("2006-01-02T15:04:05.000Z07:00"),
+		Elapsed:    result.Elapsed.String(),
+		Status:     result.Status,
+		Similarity: result.Similarity,
+		Verdict:    result.Verdict,
+		Error:      result.Error,
+		Redirects:  result.Redirects,
+		Body:       name + ".body",
+		Headers:    name + ".headers",
+		Meta:       name + ".meta.json",
+	}
+	entry.SHA256, entry.HeadersSHA256 = writeResponse(dir, name, resp)
+	if result.Waited > 0 {
+		entry.Waited = result.Waited.String()
+	}
+	entry.Chain = chainHash(prevChain, entry)
+	data := Must2(json.MarshalIndent(entry, "", "  "))
+	Must(os.WriteFile(filepath.Join(dir, entry.Meta), data, 0644))
+	return entry
+}
+
+func readManifest(dir string) ([]ManifestEntry, error) {
+	data, err := os.ReadFile(filepath.Join(dir, "manifest.json"))
+	if err != nil {
+		return nil, err
+	}
+	manifest := make([]ManifestEntry, 0)
+	return manifest, json.Unmarshal(data, &manifest)
+}
@@ -0,0 +1,490 @@
+package main
+
+import (
+	"archive/tar"
+	"cmp"
+	"compress/gzip"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/tobiashort/cfmt-go"
+	"github.com/tobiashort/clap-go"
+	. "github.com/tobiashort/utils-go/must"
+)
+
+const (
+	checksumsFile = "SHA256SUMS"
+	signatureFile = "SHA256SUMS.sig"
+	publicKeyFile = "signing.pub"
+)
+
+type ExportArgs struct {
+	RunDir string `clap:"positional,mandatory,description='Directory of the test run.'"`
+	Output string `clap:"description='Path of the archive (default: <run>.tar.gz in the current directory).'"`
+	Key    string `clap:"description='PEM file with an Ed25519 private key (PKCS #8) to sign the bundle with.'"`
+}
+
+type VerifyArgs struct {
+	Archive string `clap:"positional,mandatory,description='Evidence bundle created by wylmo export.'"`
+	Key     string `clap:"description='PEM file with the Ed25519 public key the bundle must be signed with.'"`
+}
+
+type bundleFile struct {
+	name string
+	data []byte
+}
+
+func verifyChain(manifest []ManifestEntry, read func(name string) ([]byte, error)) error {
+	reference, err := read("reference.body")
+	if err != nil {
+		return err
+	}
+	prev := sha256Hex(reference)
+	for _, entry := range manifest {
+		name := probeName(entry.Index)
+		body, err := read(entry.Body)
+		if err != nil {
+			return err
+		}
+		if sha256Hex(body) != entry.SHA256 {
+			return fmt.Errorf("%s: body does not match its hash", name)
+		}
+		headers, err := read(entry.Headers)
+		if err != nil {
+			return err
+		}
+		if sha256Hex(headers) != entry.HeadersSHA256 {
+			return fmt.Errorf("%s: headers do not match their hash", name)
+		}
+		data, err := read(entry.Meta)
+		if err != nil {
+			return err
+		}
+		meta := ManifestEntry{}
+		if err := json.Unmarshal(data, &meta); err != nil {
+			return fmt.Errorf("%s: %w", entry.Meta, err)
+		}
+		if !reflect.DeepEqual(meta, entry) {
+			return fmt.Errorf("%s: metadata does not match the manifest", name)
+		}
+		if chainHash(prev, entry) != entry.Chain {
+			return fmt.Errorf("%s: hash chain is broken", name)
+		}
+		prev = entry.Chain
+	}
+	return nil
+}
+
+func readSigningKey(path string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM data found", path)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	ed25519Key, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s: not an Ed25519 private key", path)
+	}
+	return ed25519Key, nil
+}
+
+func parsePublicKey(data []byte) (ed25519.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	ed25519Key, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("not an Ed25519 public key")
+	}
+	return ed25519Key, nil
+}
+
+func keyFingerprint(key ed25519.PublicKey) string {
+	return "SHA256:" + sha256Hex(key)
+}
+
+var multiRunSummaries = []string{"combined.json", "roles.json", "trials.json", "report.md"}
+
+// collectBundle collects every run below dir, so that combined, role and
+// trial runs are exported with all their sessions and multi-endpoint runs
+// with the probes of every endpoint.
+func collectBundle(dir string) ([]bundleFile, error) {
+	files := make([]bundleFile, 0)
+	err := filepath.WalkDir(dir, func(p string, d os.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return err
+		}
+		if _, err := os.Stat(filepath.Join(p, "state.json")); err != nil {
+			return nil
+		}
+		rel := Must2(filepath.Rel(dir, p))
+		prefix := ""
+		if rel != "." {
+			prefix = filepath.ToSlash(rel) + "/"
+		}
+		run, err := collectRun(p, prefix)
+		if err != nil {
+			return fmt.Errorf("%s%w", prefix, err)
+		}
+		files = append(files, run...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("%s contains no test run", dir)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "state.json")); err != nil {
+		for _, name := range multiRunSummaries {
+			if data, err := os.ReadFile(filepath.Join(dir, name)); err == nil {
+				files = append(files, bundleFile{name, data})
+			}
+		}
+	}
+	return files, nil
+}
+
+func collectRun(dir string, prefix string) ([]bundleFile, error) {
+	files := make([]bundleFile, 0)
+	add := func(name string, data []byte) {
+		files = append(files, bundleFile{prefix + name, data})
+	}
+	read := func(name string) ([]byte, error) {
+		return os.ReadFile(filepath.Join(dir, name))
+	}
+	data, err := read("state.json")
+	if err != nil {
+		return nil, err
+	}
+	state := RunState{}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("state.json: %w", err)
+	}
+	manifest, err := readManifest(dir)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyChain(manifest, read); err != nil {
+		return nil, err
+	}
+	if err := verifyEndpointChains(state, read); err != nil {
+		return nil, err
+	}
+	curlCommand, err := read("curl_command")
+	if err != nil {
+		return nil, err
+	}
+	add("curl_command", []byte(redact(string(curlCommand))))
+	names := []string{"reference.body", "reference.headers"}
+	for _, entry := range manifest {
+		names = append(names, entry.Body, entry.Headers, entry.Meta)
+	}
+	names = append(names, "manifest.json", "state.json", "log")
+	for _, name := range names {
+		data, err := read(name)
+		if err != nil {
+			return nil, err
+		}
+		add(name, data)
+	}
+	for _, name := range []string{"stream.log", "stream.json"} {
+		if data, err := read(name); err == nil {
+			add(name, data)
+		}
+	}
+	add("report.md", []byte(formatReport(state, manifest)))
+	return files, nil
+}
+
+func formatChecksums(files []bundleFile) []byte {
+	var b strings.Builder
+	for _, file := range files {
+		fmt.Fprintf(&b, "%s  %s\n", sha256Hex(file.data), file.name)
+	}
+	return []byte(b.String())
+}
+
+func writeBundle(output string, prefix string, files []bundleFile) error {
+	f, err := os.OpenFile(output, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	now := time.Now()
+	for _, file := range files {
+		header := &tar.Header{
+			Name:    path.Join(prefix, file.name),
+			Mode:    0644,
+			Size:    int64(len(file.data)),
+			ModTime: now,
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if _, err := tw.Write(file.data); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func exportRun(args ExportArgs) error {
+	dir, err := filepath.EvalSymlinks(args.RunDir)
+	if err != nil {
+		return err
+	}
+	files, err := collectBundle(dir)
+	if err != nil {
+		return err
+	}
+	checksums := formatChecksums(files)
+	files = append(files, bundleFile{checksumsFile, checksums})
+	if args.Key != "" {
+		key, err := readSigningKey(args.Key)
+		if err != nil {
+			return err
+		}
+		publicKey := key.Public().(ed25519.PublicKey)
+		der, err := x509.MarshalPKIXPublicKey(publicKey)
+		if err != nil {
+			return err
+		}
+		signature := base64.StdEncoding.EncodeToString(ed25519.Sign(key, checksums)) + "\n"
+		files = append(files,
+			bundleFile{signatureFile, []byte(signature)},
+			bundleFile{publicKeyFile, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})},
+		)
+		cfmt.Printf("Signed with key #yB{%s}\n", keyFingerprint(publicKey))
+	}
+	name := filepath.Base(dir)
+	output := args.Output
+	if output == "" {
+		output = name + ".tar.gz"
+	}
+	if err := writeBundle(output, name, files); err != nil {
+		return err
+	}
+	cfmt.Printf("Exported #yB{%d} files to #yB{%s}\n", len(files), output)
+	return nil
+}
+
+func readBundle(archive string) (map[string][]byte, error) {
+	f, err := os.Open(archive)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	tr := tar.NewReader(gz)
+	files := make(map[string][]byte)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if header.Typeflag != tar.TypeReg {
+			return nil, fmt.Errorf("unexpected entry %s", header.Name)
+		}
+		_, name, found := strings.Cut(header.Name, "/")
+		if !found || name == "" || path.Clean(name) != name || path.IsAbs(name) || strings.HasPrefix(name, "../") {
+			return nil, fmt.Errorf("unexpected entry %s", header.Name)
+		}
+		if _, ok := files[name]; ok {
+			return nil, fmt.Errorf("duplicate entry %s", header.Name)
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+		files[name] = data
+	}
+	return files, nil
+}
+
+func verifyChecksums(files map[string][]byte) error {
+	checksums, ok := files[checksumsFile]
+	if !ok {
+		return fmt.Errorf("%s is missing", checksumsFile)
+	}
+	listed := []string{checksumsFile, signatureFile, publicKeyFile}
+	for _, line := range strings.Split(strings.TrimSuffix(string(checksums), "\n"), "\n") {
+		sum, name, found := strings.Cut(line, "  ")
+		if !found {
+			return fmt.Errorf("%s: malformed line %q", checksumsFile, line)
+		}
+		data, ok := files[name]
+		if !ok {
+			return fmt.Errorf("%s is missing", name)
+		}
+		if sha256Hex(data) != sum {
+			return fmt.Errorf("%s does not match its checksum", name)
+		}
+		listed = append(listed, name)
+	}
+	for name := range files {
+		if !slices.Contains(listed, name) {
+			return fmt.Errorf("%s is not listed in %s", name, checksumsFile)
+		}
+	}
+	return nil
+}
+
+func verifySignature(files map[string][]byte, keyPath string) (string, error) {
+	signature, signed := files[signatureFile]
+	if !signed {
+		if keyPath != "" {
+			return "", fmt.Errorf("bundle is not signed")
+		}
+		return "", nil
+	}
+	publicKey, err := parsePublicKey(files[publicKeyFile])
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", publicKeyFile, err)
+	}
+	if keyPath != "" {
+		data, err := os.ReadFile(keyPath)
+		if err != nil {
+			return "", err
+		}
+		trusted, err := parsePublicKey(data)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", keyPath, err)
+		}
+		if !trusted.Equal(publicKey) {
+			return "", fmt.Errorf("bundle is signed with %s, not with %s", keyFingerprint(publicKey), keyFingerprint(trusted))
+		}
+	}
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(signature)))
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", signatureFile, err)
+	}
+	if !ed25519.Verify(publicKey, files[checksumsFile], sig) {
+		return "", fmt.Errorf("signature is invalid")
+	}
+	return keyFingerprint(publicKey), nil
+}
+
+func verifyBundle(args VerifyArgs) error {
+	files, err := readBundle(args.Archive)
+	if err != nil {
+		return err
+	}
+	if err := verifyChecksums(files); err != nil {
+		return err
+	}
+	cfmt.Printf("#g{OK} checksums of %d files\n", len(files))
+	prefixes := make([]string, 0)
+	for name := range files {
+		if path.Base(name) == "manifest.json" {
+			prefixes = append(prefixes, strings.TrimSuffix(name, "manifest.json"))
+		}
+	}
+	if len(prefixes) == 0 {
+		return fmt.Errorf("manifest.json is missing")
+	}
+	slices.Sort(prefixes)
+	for _, prefix := range prefixes {
+		manifest := make([]ManifestEntry, 0)
+		if err := json.Unmarshal(files[prefix+"manifest.json"], &manifest); err != nil {
+			return fmt.Errorf("%smanifest.json: %w", prefix, err)
+		}
+		err = verifyChain(manifest, func(name string) ([]byte, error) {
+			data, ok := files[prefix+name]
+			if !ok {
+				return nil, fmt.Errorf("%s%s is missing", prefix, name)
+			}
+			return data, nil
+		})
+		if err != nil {
+			return fmt.Errorf("%s%w", prefix, err)
+		}
+		if data, ok := files[prefix+"state.json"]; ok {
+			state := RunState{}
+			if err := json.Unmarshal(data, &state); err != nil {
+				return fmt.Errorf("%sstate.json: %w", prefix, err)
+			}
+			if err := verifyEndpointChains(state, func(name string) ([]byte, error) {
+				data, ok := files[prefix+name]
+				if !ok {
+					return nil, fmt.Errorf("%s%s is missing", prefix, name)
+				}
+				return data, nil
+			}); err != nil {
+				return fmt.Errorf("%s%w", prefix, err)
+			}
+		}
+		cfmt.Printf("#g{OK} hash chain over %d probes in %s\n", len(manifest), cmp.Or(strings.TrimSuffix(prefix, "/"), "the run"))
+	}
+	fingerprint, err := verifySignature(files, args.Key)
+	if err != nil {
+		return err
+	}
+	if fingerprint == "" {
+		cfmt.Printf("#y{--} bundle is not signed\n")
+	} else {
+		cfmt.Printf("#g{OK} signature by %s\n", fingerprint)
+	}
+	return nil
+}
+
+func exportCommand() {
+	args := ExportArgs{}
+	clap.Prog("wylmo export")
+	clap.Description("Export a test run as a tamper-evident evidence bundle.")
+	clap.Parse(&args)
+	if err := exportRun(args); err != nil {
+		cfmt.Printf("#r{%s}\n", err.Error())
+		os.Exit(1)
+	}
+}
+
+func verifyCommand() {
+	args := VerifyArgs{}
+	clap.Prog("wylmo verify")
+	clap.Description("Verify the integrity of an evidence bundle created by wylmo export.")
+	clap.Parse(&args)
+	if err := verifyBundle(args); err != nil {
+		cfmt.Printf("#r{FAILED %s}\n", err.Error())
+		os.Exit(1)
+	}
+	cfmt.Printf("#gB{Bundle is intact}\n")
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/tobiashort/cfmt-go"
+	. "github.com/tobiashort/utils-go/must"
+)
+
+const (
+	findingPass         = "pass"
+	findingFail         = "fail"
+	findingInconclusive = "inconclusive"
+	findingInfo         = "info"
+)
+
+type Finding struct {
+	Result  string   `json:"result"`
+	Summary string   `json:"summary"`
+	Details []string `json:"details,omitempty"`
+}
+
+func startFindingSession(dir string, typeOfTest string, curlCommand string, req Request) *Run {
+	writeRequest(dir, curlCommand, req)
+	writeResponse(dir, "reference", referenceResponse)
+	run := newRun(dir, typeOfTest)
+	run.reference = referenceResponse
+	run.state.Finding = &Finding{Result: findingInconclusive, Summary: "the test did not complete"}
+	return run
+}
+
+func (run *Run) Note(format string, args ...any) {
+	detail := redact(fmt.Sprintf(format, args...))
+	run.state.Finding.Details = append(run.state.Finding.Details, detail)
+	cfmt.Fprintf(console, "%s%v %s\n", run.prefix(), formatTime(time.Now()), detail)
+	Must2(fmt.Fprintf(run.logFile, "%v %s\n", formatTime(time.Now()), detail))
+}
+
+func (run *Run) Conclude(result string, format string, args ...any) {
+	run.state.Finding.Result = result
+	run.state.Finding.Summary = redact(fmt.Sprintf(format, args...))
+	run.state.Verdict = run.summary()
+	run.save()
+}
+
+func checkAccess(ctx context.Context, run *Run, req Request) ProbeResult {
+	return checkAccessWith(ctx, run, newHTTPClient(req), req)
+}
+
+func checkAccessWith(ctx context.Context, run *Run, client *http.Client, req Request) ProbeResult {
+	result, _ := checkAccessResponse(ctx, run, client, req)
+	return result
+}
+
+func checkAccessResponse(ctx context.Context, run *Run, client *http.Client, req Request) (ProbeResult, Response) {
+	resp, err := sendRequestWith(ctx, client, req)
+	now := time.Now()
+	result := ProbeResult{Time: now, Elapsed: now.Sub(startTime), Verdict: verdictInconclusive}
+	if err != nil {
+		result.Error = redact(err.Error())
+	} else {
+		result.Status = resp.StatusCode
+		result.Similarity = similarityTo(run.reference, resp)
+		result.Verdict = verdictFor(result.Similarity)
+	}
+	run.Record(result, resp)
+	return run.state.Probes[len(run.state.Probes)-1], resp
+}
+
+func responseCookies(resp Response) []*http.Cookie {
+	cookies := make([]*http.Cookie, 0)
+	for _, cookie := range (&http.Response{Header: resp.Header}).Cookies() {
+		if cookie.MaxAge >= 0 && cookie.Value != "" {
+			cookies = append(cookies, cookie)
+		}
+	}
+	return cookies
+}
+
+func cookieNames(cookies []*http.Cookie) string {
+	names := make([]string, 0, len(cookies))
+	for _, cookie := range cookies {
+		names = append(names, cookie.Name)
+	}
+	return strings.Join(names, ", ")
+}
+
+func withSession(target Request, session Request) Request {
+	target = target.Clone()
+	for _, name := range []string{"Cookie", "Authorization"} {
+		if value := session.Header.Get(name); value != "" {
+			target.Header.Set(name, value)
+		} else {
+			target.Header.Del(name)
+		}
+	}
+	return target
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/tobiashort/cfmt-go"
+)
+
+var preAuthURLArg string
+
+func preAuthCookies(ctx context.Context, run *Run) ([]*http.Cookie, error) {
+	preAuth := loginRequest.Clone()
+	preAuth.Method = http.MethodGet
+	preAuth.Body = ""
+	if preAuthURLArg != "" {
+		preAuth.URL = preAuthURLArg
+	}
+	for _, name := range []string{"Cookie", "Authorization", "Content-Type"} {
+		preAuth.Header.Del(name)
+	}
+	resp, err := sendRequest(ctx, preAuth)
+	if err != nil {
+		return nil, err
+	}
+	writeResponse(run.dir, "pre-auth", resp)
+	cookies := responseCookies(resp)
+	if len(cookies) > 0 {
+		run.Note("Pre-authentication response (%s) sets %s", resp.Status, cookieNames(cookies))
+		return cookies, nil
+	}
+	cookies, err = http.ParseCookie(loginRequest.Header.Get("Cookie"))
+	if err == nil && len(cookies) > 0 {
+		run.Note("Pre-authentication response (%s) sets no cookies, using %s from the login request", resp.Status, cookieNames(cookies))
+		return cookies, nil
+	}
+	return nil, nil
+}
+
+func joinCookies(cookies []*http.Cookie) string {
+	pairs := make([]string, 0, len(cookies))
+	for _, cookie := range cookies {
+		pairs = append(pairs, cookie.Name+"="+cookie.Value)
+	}
+	return strings.Join(pairs, "; ")
+}
+
+func performSessionFixationTest(ctx context.Context, dir string, curlCommand string, req Request) *Run {
+	cfmt.Printf("Performing #yB{'%s'} test...\n", sessionFixationTest)
+	startTime = time.Now()
+	run := startFindingSession(dir, sessionFixationTest, curlCommand, req)
+	defer run.Finish(ctx)
+
+	preCookies, err := preAuthCookies(ctx, run)
+	if err != nil {
+		run.Conclude(findingInconclusive, "pre-authentication request failed: %s", err.Error())
+		return run
+	}
+	if len(preCookies) == 0 {
+		run.Conclude(findingInconclusive, "no pre-authentication session cookie, neither the pre-authentication response nor the login request carries one")
+		return run
+	}
+	for _, cookie := range preCookies {
+		addCookieSecret(cookie.Name, cookie.Value)
+	}
+
+	login := loginRequest.Clone()
+	login.Header.Set("Cookie", mergeCookies(login.Header.Get("Cookie"), preCookies))
+	loginResp, loginCookies, err := sendLogin(ctx, login, req.URL)
+	if err != nil {
+		run.Conclude(findingInconclusive, "login request failed: %s", err.Error())
+		return run
+	}
+	writeResponse(dir, "login", loginResp)
+	for _, cookie := range loginCookies {
+		addCookieSecret(cookie.Name, cookie.Value)
+	}
+	renewed := make([]*http.Cookie, 0)
+	kept := make([]*http.Cookie, 0)
+	for _, pre := range preCookies {
+		index := slices.IndexFunc(loginCookies, func(cookie *http.Cookie) bool { return cookie.Name == pre.Name })
+		if index >= 0 && loginCookies[index].Value != pre.Value {
+			renewed = append(renewed, pre)
+		} else {
+			kept = append(kept, pre)
+		}
+	}
+	issued := slices.DeleteFunc(slices.Clone(loginCookies), func(cookie *http.Cookie) bool {
+		return slices.ContainsFunc(preCookies, func(pre *http.Cookie) bool { return pre.Name == cookie.Name })
+	})
+	run.Note("Login response (%s) renews [%s], keeps [%s] and newly sets [%s]", loginResp.Status, cookieNames(renewed), cookieNames(kept), cookieNames(issued))
+
+	fixated := req.Clone()
+	fixated.Header.Del("Authorization")
+	fixated.Header.Set("Cookie", joinCookies(preCookies))
+	cfmt.Fprintf(console, "Checking access with the pre-login session identifier...\n")
+	before := checkAccess(ctx, run, fixated)
+
+	session := req.Clone()
+	session.Header.Del("Authorization")
+	session.Header.Set("Cookie", mergeCookies(joinCookies(preCookies), loginCookies))
+	cfmt.Fprintf(console, "Checking access with the session after login...\n")
+	after := checkAccess(ctx, run, session)
+
+	switch {
+	case ctx.Err() != nil:
+	case after.Verdict != verdictAuthenticated:
+		run.Conclude(findingInconclusive, "the login did not produce an authenticated cookie session (%s)", after.Verdict)
+	case before.Verdict == verdictAuthenticated && len(renewed) == 0:
+		run.Conclude(findingFail, "session identifier is not renewed at login and the pre-login identifier grants authenticated access")
+	case before.Verdict == verdictAuthenticated:
+		run.Conclude(findingFail, "new identifier is issued at login, but the pre-login identifier still grants authenticated access")
+	case before.Verdict == verdictInconclusive:
+		run.Conclude(findingInconclusive, "access with the pre-login identifier could not be checked: %s", before.Error)
+	case len(renewed) > 0:
+		run.Conclude(findingPass, "session identifier is renewed at login (%s) and the pre-login identifier is rejected", cookieNames(renewed))
+	default:
+		run.Conclude(findingPass, "pre-login identifier is rejected, the authenticated session is carried by cookies set at login (%s)", cookieNames(issued))
+	}
+	return run
+}
@@ -0,0 +1,389 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+)
+
+const (
+	curlFormat       = "curl"
+	fetchFormat      = "fetch"
+	powerShellFormat = "PowerShell"
+	httpieFormat     = "HTTPie"
+)
+
+var (
+	fetchRegexp           = regexp.MustCompile(`^(?:await\s+)?fetch\(\s*("(?:[^"\\]|\\.)*")\s*,\s*`)
+	powerShellString      = "(\"(?:[^\"`]|`.|\"\")*\"|'(?:[^']|'')*')"
+	powerShellUserAgent   = regexp.MustCompile(`\$session\.UserAgent\s*=\s*` + powerShellString)
+	powerShellCookie      = regexp.MustCompile(`System\.Net\.Cookie\(\s*` + powerShellString + `\s*,\s*` + powerShellString)
+	powerShellURI         = regexp.MustCompile(`(?i)-Uri\s+` + powerShellString)
+	powerShellMethod      = regexp.MustCompile(`(?i)-Method\s+(?:` + powerShellString + `|(\w+))`)
+	powerShellContentType = regexp.MustCompile(`(?i)-ContentType\s+` + powerShellString)
+	powerShellBody        = regexp.MustCompile(`(?i)-Body\s+(?:\(\[System\.Text\.Encoding\]::UTF8\.GetBytes\()?` + powerShellString)
+	powerShellHeaders     = regexp.MustCompile(`(?i)-Headers\s+@\{`)
+	powerShellHeader      = regexp.MustCompile(`^[\s;]*` + powerShellString + `\s*=\s*` + powerShellString)
+)
+
+func detectCommandFormat(command string) (string, bool) {
+	words := strings.Fields(command)
+	if len(words) == 0 {
+		return "", false
+	}
+	switch {
+	case words[0] == "curl":
+		return curlFormat, true
+	case fetchRegexp.MatchString(command):
+		return fetchFormat, true
+	case strings.HasPrefix(words[0], "$session") || strings.EqualFold(words[0], "Invoke-WebRequest") || strings.EqualFold(words[0], "Invoke-RestMethod"):
+		return powerShellFormat, true
+	case words[0] == "http" || words[0] == "https":
+		return httpieFormat, true
+	default:
+		return "", false
+	}
+}
+
+func parseCommand(format string, command string) (Request, error) {
+	switch format {
+	case curlFormat:
+		return parseCurlCommand(command)
+	case fetchFormat:
+		return parseFetchCommand(command)
+	case powerShellFormat:
+		return parsePowerShellCommand(command)
+	case httpieFormat:
+		return parseHTTPieCommand(command)
+	default:
+		panic("Unknown command format: " + format)
+	}
+}
+
+func parseFetchCommand(command string) (Request, error) {
+	match := fetchRegexp.FindStringSubmatchIndex(command)
+	if match == nil {
+		return Request{}, fmt.Errorf("not a fetch command")
+	}
+	req := Request{Method: http.MethodGet, Header: make(http.Header), FollowRedirects: true}
+	if err := json.Unmarshal([]byte(command[match[2]:match[3]]), &req.URL); err != nil {
+		return Request{}, err
+	}
+	options := struct {
+		Headers  map[string]string `json:"headers"`
+		Body     *string           `json:"body"`
+		Method   string            `json:"method"`
+		Referrer string            `json:"referrer"`
+	}{}
+	rest := strings.TrimSpace(command[match[1]:])
+	rest = strings.TrimSuffix(rest, ";")
+	rest = strings.TrimSuffix(strings.TrimSpace(rest), ")")
+	if err := json.Unmarshal([]byte(rest), &options); err != nil {
+		return Request{}, fmt.Errorf("cannot parse fetch options: %w", err)
+	}
+	if options.Method != "" {
+		req.Method = strings.ToUpper(options.Method)
+	}
+	for name, value := range options.Headers {
+		req.Header.Set(name, value)
+	}
+	if options.Referrer != "" && req.Header.Get("Referer") == "" {
+		req.Header.Set("Referer", options.Referrer)
+	}
+	if options.Body != nil {
+		req.Body = *options.Body
+	}
+	dropTransportHeaders(req.Header)
+	if _, err := url.ParseRequestURI(req.URL); err != nil {
+		return Request{}, err
+	}
+	return req, nil
+}
+
+func unquotePowerShell(s string) string {
+	if strings.HasPrefix(s, "'") {
+		return strings.ReplaceAll(s[1:len(s)-1], "''", "'")
+	}
+	s = s[1 : len(s)-1]
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '`' && i+1 < len(s):
+			i++
+			switch s[i] {
+			case 'n':
+				b.WriteByte('\n')
+			case 'r':
+				b.WriteByte('\r')
+			case 't':
+				b.WriteByte('\t')
+			case '0':
+				b.WriteByte(0)
+			default:
+				b.WriteByte(s[i])
+			}
+		case s[i] == '"' && i+1 < len(s) && s[i+1] == '"':
+			i++
+			b.WriteByte('"')
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
+
+func parsePowerShellCommand(command string) (Request, error) {
+	req := Request{Method: http.MethodGet, Header: make(http.Header), FollowRedirects: true}
+	match := powerShellURI.FindStringSubmatch(command)
+	if match == nil {
+		return Request{}, fmt.Errorf("missing -Uri")
+	}
+	req.URL = unquotePowerShell(match[1])
+	if match = powerShellMethod.FindStringSubmatch(command); match != nil {
+		if match[1] != "" {
+			req.Method = strings.ToUpper(unquotePowerShell(match[1]))
+		} else {
+			req.Method = strings.ToUpper(match[2])
+		}
+	}
+	if match = powerShellUserAgent.FindStringSubmatch(command); match != nil {
+		req.Header.Set("User-Agent", unquotePowerShell(match[1]))
+	}
+	cookies := make([]string, 0)
+	for _, match := range powerShellCookie.FindAllStringSubmatch(command, -1) {
+		cookies = append(cookies, unquotePowerShell(match[1])+"="+unquotePowerShell(match[2]))
+	}
+	if loc := powerShellHeaders.FindStringIndex(command); loc != nil {
+		rest := command[loc[1]:]
+		for {
+			match := powerShellHeader.FindStringSubmatch(rest)
+			if match == nil {
+				break
+			}
+			rest = rest[len(match[0]):]
+			name := unquotePowerShell(match[1])
+			switch name {
+			case "authority", "method", "path", "scheme":
+				continue
+			}
+			req.Header.Add(name, unquotePowerShell(match[2]))
+		}
+		if !strings.HasPrefix(strings.TrimLeft(rest, " \t\r\n;"), "}") {
+			return Request{}, fmt.Errorf("cannot parse -Headers")
+		}
+	}
+	if len(cookies) > 0 {
+		if existing := req.Header.Get("Cookie"); existing != "" {
+			cookies = append([]string{existing}, cookies...)
+		}
+		req.Header.Set("Cookie", strings.Join(cookies, "; "))
+	}
+	if match = powerShellContentType.FindStringSubmatch(command); match != nil {
+		req.Header.Set("Content-Type", unquotePowerShell(match[1]))
+	}
+	if match = powerShellBody.FindStringSubmatch(command); match != nil {
+		req.Body = unquotePowerShell(match[1])
+	}
+	dropTransportHeaders(req.Header)
+	if _, err := url.ParseRequestURI(req.URL); err != nil {
+		return Request{}, err
+	}
+	return req, nil
+}
+
+func splitHTTPieItem(item string) (string, string, string, bool) {
+	separators := []string{":=@", "=@", "==", ":=", "@", "=", ":"}
+	var key strings.Builder
+	for i := 0; i < len(item); i++ {
+		if item[i] == '\\' && i+1 < len(item) {
+			i++
+			key.WriteByte(item[i])
+			continue
+		}
+		for _, sep := range separators {
+			if strings.HasPrefix(item[i:], sep) {
+				return key.String(), sep, item[i+len(sep):], true
+			}
+		}
+		key.WriteByte(item[i])
+	}
+	return "", "", "", false
+}
+
+func parseHTTPieCommand(command string) (Request, error) {
+	words, err := splitShellWords(command)
+	if err != nil {
+		return Request{}, err
+	}
+	if len(words) == 0 || (words[0] != "http" && words[0] != "https") {
+		return Request{}, fmt.Errorf("not an HTTPie command")
+	}
+	scheme := words[0]
+	req := Request{Header: make(http.Header)}
+	form := false
+	auth := ""
+	authType := ""
+	positional := make([]string, 0)
+	for i := 1; i < len(words); i++ {
+		word := words[i]
+		flag, value, hasValue := strings.Cut(word, "=")
+		nextValue := func() (string, error) {
+			if hasValue {
+				return value, nil
+			}
+			if i+1 >= len(words) {
+				return "", fmt.Errorf("missing value for %s", word)
+			}
+			i++
+			return words[i], nil
+		}
+		if !strings.HasPrefix(word, "-") {
+			positional = append(positional, word)
+			continue
+		}
+		switch flag {
+		case "-f", "--form":
+			form = true
+		case "-j", "--json":
+			form = false
+		case "-F", "--follow":
+			req.FollowRedirects = true
+		case "--verify":
+			v, err := nextValue()
+			if err != nil {
+				return Request{}, err
+			}
+			req.Insecure = v == "no" || v == "false"
+		case "-a", "--auth":
+			if auth, err = nextValue(); err != nil {
+				return Request{}, err
+			}
+		case "-A", "--auth-type":
+			if authType, err = nextValue(); err != nil {
+				return Request{}, err
+			}
+		case "-p", "--print", "--pretty", "-s", "--style", "--timeout":
+			if _, err := nextValue(); err != nil {
+				return Request{}, err
+			}
+		case "-v", "--verbose", "-h", "--headers", "-b", "--body", "--ignore-stdin":
+		default:
+			return Request{}, fmt.Errorf("unsupported HTTPie option: %s", word)
+		}
+	}
+	switch {
+	case auth == "":
+	case authType == "bearer":
+		req.Header.Set("Authorization", "Bearer "+auth)
+	case authType == "" || authType == "basic":
+		req.Header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(auth)))
+	default:
+		return Request{}, fmt.Errorf("unsupported HTTPie auth type: %s", authType)
+	}
+	if len(positional) == 0 {
+		return Request{}, fmt.Errorf("missing URL")
+	}
+	if strings.ToUpper(positional[0]) == positional[0] && len(positional) > 1 && !strings.ContainsAny(positional[0], ":/=") {
+		req.Method = positional[0]
+		positional = positional[1:]
+	}
+	req.URL = positional[0]
+	if strings.HasPrefix(req.URL, ":") {
+		req.URL = "localhost" + req.URL
+	}
+	if !strings.Contains(req.URL, "://") {
+		req.URL = scheme + "://" + req.URL
+	}
+	query := make([]string, 0)
+	fields := make(map[string]json.RawMessage)
+	fieldNames := make([]string, 0)
+	formFields := url.Values{}
+	for _, item := range positional[1:] {
+		key, sep, value, ok := splitHTTPieItem(item)
+		if !ok {
+			return Request{}, fmt.Errorf("invalid request item: %s", item)
+		}
+		switch sep {
+		case ":":
+			req.Header.Add(key, value)
+		case "==":
+			query = append(query, url.QueryEscape(key)+"="+url.QueryEscape(value))
+		case "=":
+			if form {
+				formFields.Add(key, value)
+				continue
+			}
+			if _, exists := fields[key]; !exists {
+				fieldNames = append(fieldNames, key)
+			}
+			fields[key], _ = json.Marshal(value)
+		case ":=":
+			if !json.Valid([]byte(value)) {
+				return Request{}, fmt.Errorf("invalid JSON in request item: %s", item)
+			}
+			if _, exists := fields[key]; !exists {
+				fieldNames = append(fieldNames, key)
+			}
+			fields[key] = json.RawMessage(value)
+		default:
+			return Request{}, fmt.Errorf("file request items are not supported: %s", item)
+		}
+	}
+	if len(query) > 0 {
+		sep := "?"
+		if strings.Contains(req.URL, "?") {
+			sep = "&"
+		}
+		req.URL += sep + strings.Join(query, "&")
+	}
+	switch {
+	case form && len(formFields) > 0:
+		req.Body = formFields.Encode()
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	case len(fieldNames) > 0:
+		parts := make([]string, len(fieldNames))
+		for i, name := range fieldNames {
+			key, _ := json.Marshal(name)
+			parts[i] = string(key) + ": " + string(fields[name])
+		}
+		req.Body = "{" + strings.Join(parts, ", ") + "}"
+		if req.Header.Get("Content-Type") == "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		if req.Header.Get("Accept") == "" {
+			req.Header.Set("Accept", "application/json, */*;q=0.5")
+		}
+	}
+	if req.Method == "" {
+		req.Method = http.MethodGet
+		if req.Body != "" {
+			req.Method = http.MethodPost
+		}
+	}
+	if _, err := url.ParseRequestURI(req.URL); err != nil {
+		return Request{}, err
+	}
+	return req, nil
+}
+
+func readCommandFile(path string) (Request, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Request{}, err
+	}
+	command := strings.TrimSpace(string(data))
+	format, ok := detectCommandFormat(command)
+	if !ok {
+		return Request{}, fmt.Errorf("%s: not a supported command", path)
+	}
+	req, err := parseCommand(format, command)
+	if err != nil {
+		return Request{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return req, nil
+}
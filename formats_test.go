@@ -0,0 +1,178 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"testing"
+)
+
+func TestDetectCommandFormat(t *testing.T) {
+	tests := []struct {
+		command string
+		format  string
+	}{
+		{`curl 'https://example.com/'`, curlFormat},
+		{`fetch("https://example.com/", {"method": "GET"});`, fetchFormat},
+		{`await fetch("https://example.com/", {});`, fetchFormat},
+		{`$session = New-Object Microsoft.PowerShell.Commands.WebRequestSession`, powerShellFormat},
+		{`Invoke-WebRequest -UseBasicParsing -Uri "https://example.com/"`, powerShellFormat},
+		{`http POST example.com/api name=wylmo`, httpieFormat},
+		{`https example.com`, httpieFormat},
+	}
+	for _, test := range tests {
+		format, ok := detectCommandFormat(test.command)
+		if !ok || format != test.format {
+			t.Errorf("detectCommandFormat(%q) = %q, %v; want %q", test.command, format, ok, test.format)
+		}
+	}
+	if format, ok := detectCommandFormat("wget https://example.com/"); ok {
+		t.Errorf("detectCommandFormat(wget) = %q; want no format", format)
+	}
+}
+
+func TestParseCurlCommand(t *testing.T) {
+	req, err := parseCurlCommand(`curl -s -L 'https://example.com/api' -H 'Accept: application/json' -b 'sid=abc' --data-raw '{"a":1}' --compressed`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.Method != http.MethodPost || req.URL != "https://example.com/api" || req.Body != `{"a":1}` {
+		t.Errorf("unexpected request: %s %s %q", req.Method, req.URL, req.Body)
+	}
+	if req.Header.Get("Accept") != "application/json" || req.Header.Get("Cookie") != "sid=abc" {
+		t.Errorf("unexpected headers: %v", req.Header)
+	}
+	if !req.FollowRedirects || len(req.CurlOptions) != 0 {
+		t.Errorf("FollowRedirects = %v, CurlOptions = %v", req.FollowRedirects, req.CurlOptions)
+	}
+}
+
+func TestParseCurlCommandPassesUnknownOptionsThrough(t *testing.T) {
+	req, err := parseCurlCommand(`curl --http1.1 -o /dev/null -w '%{http_code}' https://example.com/`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"--http1.1", "-o", "/dev/null", "-w", "%{http_code}"}
+	if !slices.Equal(req.CurlOptions, want) {
+		t.Errorf("CurlOptions = %q; want %q", req.CurlOptions, want)
+	}
+	if req.URL != "https://example.com/" {
+		t.Errorf("URL = %q", req.URL)
+	}
+}
+
+func TestParseFetchCommand(t *testing.T) {
+	req, err := parseFetchCommand(`fetch("https://example.com/api", {
+  "headers": {"accept": "application/json", "cookie": "sid=abc", "content-length": "7"},
+  "referrer": "https://example.com/",
+  "body": "{\"a\":1}",
+  "method": "post",
+  "mode": "cors"
+});`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.Method != http.MethodPost || req.URL != "https://example.com/api" || req.Body != `{"a":1}` {
+		t.Errorf("unexpected request: %s %s %q", req.Method, req.URL, req.Body)
+	}
+	if req.Header.Get("Cookie") != "sid=abc" || req.Header.Get("Referer") != "https://example.com/" {
+		t.Errorf("unexpected headers: %v", req.Header)
+	}
+	if req.Header.Get("Content-Length") != "" {
+		t.Errorf("transport header Content-Length was kept")
+	}
+}
+
+func TestParsePowerShellCommand(t *testing.T) {
+	req, err := parsePowerShellCommand("$session = New-Object Microsoft.PowerShell.Commands.WebRequestSession\n" +
+		"$session.UserAgent = \"Mozilla/5.0\"\n" +
+		"$session.Cookies.Add((New-Object System.Net.Cookie(\"sid\", \"abc\", \"/\", \"example.com\")))\n" +
+		"Invoke-WebRequest -UseBasicParsing -Uri \"https://example.com/api\" `\n" +
+		"-Method \"POST\" `\n" +
+		"-WebSession $session `\n" +
+		"-Headers @{\n" +
+		"\"authority\"=\"example.com\"\n" +
+		"  \"method\"=\"POST\"\n" +
+		"  \"accept\"=\"application/json\"\n" +
+		"  \"x-note\"='it''s'\n" +
+		"} `\n" +
+		"-ContentType \"application/json\" `\n" +
+		"-Body \"{`\"a`\":1}\"")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.Method != http.MethodPost || req.URL != "https://example.com/api" || req.Body != `{"a":1}` {
+		t.Errorf("unexpected request: %s %s %q", req.Method, req.URL, req.Body)
+	}
+	want := map[string]string{
+		"User-Agent":   "Mozilla/5.0",
+		"Cookie":       "sid=abc",
+		"Accept":       "application/json",
+		"X-Note":       "it's",
+		"Content-Type": "application/json",
+	}
+	for name, value := range want {
+		if got := req.Header.Get(name); got != value {
+			t.Errorf("header %s = %q; want %q", name, got, value)
+		}
+	}
+	if req.Header.Get("authority") != "" || req.Header.Get("method") != "" {
+		t.Errorf("pseudo headers were kept: %v", req.Header)
+	}
+}
+
+func TestParseHTTPieCommand(t *testing.T) {
+	tests := []struct {
+		command string
+		method  string
+		url     string
+		body    string
+		header  map[string]string
+	}{
+		{
+			command: `http example.com/api q==a\ b`,
+			method:  http.MethodGet,
+			url:     "http://example.com/api?q=a+b",
+		},
+		{
+			command: `https PUT example.com/api name=wylmo count:=2 X-Token:abc`,
+			method:  http.MethodPut,
+			url:     "https://example.com/api",
+			body:    `{"name": "wylmo", "count": 2}`,
+			header:  map[string]string{"Content-Type": "application/json", "X-Token": "abc"},
+		},
+		{
+			command: `http --form :8080/login user=alice`,
+			method:  http.MethodPost,
+			url:     "http://localhost:8080/login",
+			body:    "user=alice",
+			header:  map[string]string{"Content-Type": "application/x-www-form-urlencoded; charset=utf-8"},
+		},
+		{
+			command: `http -A bearer -a token123 example.com`,
+			method:  http.MethodGet,
+			url:     "http://example.com",
+			header:  map[string]string{"Authorization": "Bearer token123"},
+		},
+	}
+	for _, test := range tests {
+		req, err := parseHTTPieCommand(test.command)
+		if err != nil {
+			t.Errorf("parseHTTPieCommand(%q): %v", test.command, err)
+			continue
+		}
+		if req.Method != test.method || req.URL != test.url || req.Body != test.body {
+			t.Errorf("parseHTTPieCommand(%q) = %s %s %q; want %s %s %q", test.command, req.Method, req.URL, req.Body, test.method, test.url, test.body)
+		}
+		for name, value := range test.header {
+			if got := req.Header.Get(name); got != value {
+				t.Errorf("parseHTTPieCommand(%q): header %s = %q; want %q", test.command, name, got, value)
+			}
+		}
+	}
+}
+
+func TestParseHTTPieCommandRejectsFileItems(t *testing.T) {
+	if _, err := parseHTTPieCommand(`http POST example.com file@/etc/passwd`); err == nil {
+		t.Error("file request item was accepted")
+	}
+}
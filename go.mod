@@ -9,11 +9,11 @@ require (
 	github.com/tobiashort/clap-go v0.0.0-20250825105453-cb1aa788e679
 	github.com/tobiashort/cosine-similarity-go v0.0.0-20250729190741-e9947fca52fd
 	github.com/tobiashort/utils-go v0.0.0-20250814112205-1cad8d3011ac
+	golang.org/x/term v0.34.0
 )
 
 require (
 	github.com/tobiashort/isatty-go v0.0.0-20250729193227-00bbda39413c // indirect
 	github.com/tobiashort/orderedmap-go v0.0.0-20250808211554-a621a4f4674c // indirect
 	golang.org/x/sys v0.35.0 // indirect
-	golang.org/x/term v0.34.0 // indirect
 )
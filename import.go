@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/tobiashort/ansi-go"
+	"github.com/tobiashort/cfmt-go"
+	"github.com/tobiashort/choose-go"
+)
+
+type harFile struct {
+	Log struct {
+		Entries []struct {
+			Request struct {
+				Method  string `json:"method"`
+				URL     string `json:"url"`
+				Headers []struct {
+					Name  string `json:"name"`
+					Value string `json:"value"`
+				} `json:"headers"`
+				PostData *struct {
+					MimeType string `json:"mimeType"`
+					Text     string `json:"text"`
+				} `json:"postData"`
+			} `json:"request"`
+			Response struct {
+				Status int `json:"status"`
+			} `json:"response"`
+		} `json:"entries"`
+	} `json:"log"`
+}
+
+type burpItems struct {
+	Items []struct {
+		URL      string `xml:"url"`
+		Protocol string `xml:"protocol"`
+		Method   string `xml:"method"`
+		Status   string `xml:"status"`
+		Request  struct {
+			Base64 bool   `xml:"base64,attr"`
+			Data   string `xml:",chardata"`
+		} `xml:"request"`
+	} `xml:"item"`
+}
+
+func readFilePath(prompt string) string {
+	fmt.Println(prompt)
+	cfmt.Begin(ansi.DecorPurple)
+	path := readLine()
+	cfmt.End()
+	return path
+}
+
+func pickEntry(prompt string, labels []string) (int, bool) {
+	if len(labels) == 1 {
+		return 0, true
+	}
+	options := make([]string, len(labels))
+	for i, label := range labels {
+		options[i] = fmt.Sprintf("#%d %s", i+1, label)
+	}
+	selected, ok := choose.One(prompt, options)
+	if !ok {
+		return 0, false
+	}
+	index, _ := strconv.Atoi(strings.TrimPrefix(strings.Fields(selected)[0], "#"))
+	return index - 1, true
+}
+
+func requestHARFile() (string, Request) {
+	path := readFilePath("Please enter the path to the HAR file.")
+	req, err := loadHARFile(path)
+	if err != nil {
+		cfmt.Println("#r{Cannot load HAR file}")
+		cfmt.CPrintln(ansi.DecorRed, err.Error())
+		return requestHARFile()
+	}
+	if reviewReference(req) {
+		return req.CurlCommand(), req
+	}
+	return requestHARFile()
+}
+
+func loadHARFile(path string) (Request, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Request{}, err
+	}
+	har := harFile{}
+	if err := json.Unmarshal(data, &har); err != nil {
+		return Request{}, err
+	}
+	entries := har.Log.Entries
+	if len(entries) == 0 {
+		return Request{}, fmt.Errorf("no entries in HAR file")
+	}
+	labels := make([]string, len(entries))
+	for i, entry := range entries {
+		labels[i] = fmt.Sprintf("%s %s (%d)", entry.Request.Method, entry.Request.URL, entry.Response.Status)
+	}
+	index, ok := pickEntry("Please choose the HAR entry", labels)
+	if !ok {
+		return Request{}, fmt.Errorf("no HAR entry chosen")
+	}
+	entry := entries[index].Request
+	req := Request{Method: entry.Method, URL: entry.URL, Header: make(http.Header)}
+	for _, header := range entry.Headers {
+		if strings.HasPrefix(header.Name, ":") {
+			continue
+		}
+		req.Header.Add(header.Name, header.Value)
+	}
+	if entry.PostData != nil {
+		req.Body = entry.PostData.Text
+		if req.Header.Get("Content-Type") == "" && entry.PostData.MimeType != "" {
+			req.Header.Set("Content-Type", entry.PostData.MimeType)
+		}
+	}
+	dropTransportHeaders(req.Header)
+	return req, nil
+}
+
+func requestBurpItem() (string, Request) {
+	path := readFilePath("Please enter the path to the Burp Suite saved item.")
+	req, err := loadBurpItem(path)
+	if err != nil {
+		cfmt.Println("#r{Cannot load Burp Suite saved item}")
+		cfmt.CPrintln(ansi.DecorRed, err.Error())
+		return requestBurpItem()
+	}
+	if reviewReference(req) {
+		return req.CurlCommand(), req
+	}
+	return requestBurpItem()
+}
+
+func loadBurpItem(path string) (Request, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Request{}, err
+	}
+	items := burpItems{}
+	if err := xml.Unmarshal(data, &items); err != nil {
+		return Request{}, err
+	}
+	if len(items.Items) == 0 {
+		return Request{}, fmt.Errorf("no items in Burp Suite saved item")
+	}
+	labels := make([]string, len(items.Items))
+	for i, item := range items.Items {
+		labels[i] = fmt.Sprintf("%s %s (%s)", item.Method, item.URL, item.Status)
+	}
+	index, ok := pickEntry("Please choose the Burp Suite item", labels)
+	if !ok {
+		return Request{}, fmt.Errorf("no Burp Suite item chosen")
+	}
+	item := items.Items[index]
+	raw := []byte(item.Request.Data)
+	if item.Request.Base64 {
+		if raw, err = base64.StdEncoding.DecodeString(strings.TrimSpace(item.Request.Data)); err != nil {
+			return Request{}, err
+		}
+	}
+	target, err := url.Parse(item.URL)
+	if err != nil {
+		return Request{}, err
+	}
+	return parseRawHTTPRequest(string(raw), target.Scheme+"://"+target.Host)
+}
+
+func requestRawHTTPFile() (string, Request) {
+	path := readFilePath("Please enter the path to the raw HTTP request file.")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		cfmt.Println("#r{Cannot load raw HTTP request file}")
+		cfmt.CPrintln(ansi.DecorRed, err.Error())
+		return requestRawHTTPFile()
+	}
+	scheme := "http"
+	if choose.YesNo("Is the target using HTTPS?", choose.DEFAULT_YES) {
+		scheme = "https"
+	}
+	req, err := parseRawHTTPRequest(string(data), scheme+"://")
+	if err != nil {
+		cfmt.Println("#r{Cannot parse raw HTTP request file}")
+		cfmt.CPrintln(ansi.DecorRed, err.Error())
+		return requestRawHTTPFile()
+	}
+	if reviewReference(req) {
+		return req.CurlCommand(), req
+	}
+	return requestRawHTTPFile()
+}
+
+func parseRawHTTPRequest(raw string, origin string) (Request, error) {
+	head, body, found := strings.Cut(raw, "\r\n\r\n")
+	if !found {
+		head, body, _ = strings.Cut(raw, "\n\n")
+	}
+	scanner := bufio.NewScanner(strings.NewReader(head))
+	if !scanner.Scan() {
+		return Request{}, fmt.Errorf("missing request line")
+	}
+	requestLine := strings.Fields(scanner.Text())
+	if len(requestLine) < 2 {
+		return Request{}, fmt.Errorf("invalid request line: %s", scanner.Text())
+	}
+	req := Request{Method: requestLine[0], Header: make(http.Header), Body: body}
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return Request{}, fmt.Errorf("invalid header: %s", line)
+		}
+		req.Header.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+	target := requestLine[1]
+	if strings.HasPrefix(target, "http://") || strings.HasPrefix(target, "https://") {
+		req.URL = target
+	} else {
+		if strings.HasSuffix(origin, "://") {
+			host := req.Header.Get("Host")
+			if host == "" {
+				return Request{}, fmt.Errorf("missing Host header")
+			}
+			origin += host
+		}
+		req.URL = origin + target
+	}
+	dropTransportHeaders(req.Header)
+	if _, err := url.ParseRequestURI(req.URL); err != nil {
+		return Request{}, err
+	}
+	return req, nil
+}
+
+func dropTransportHeaders(header http.Header) {
+	for _, name := range []string{"Host", "Content-Length", "Connection", "Transfer-Encoding", "Accept-Encoding"} {
+		header.Del(name)
+	}
+}
@@ -2,12 +2,15 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"io"
+	"iter"
 	"os"
-	"os/exec"
 	"os/signal"
+	"path/filepath"
 	"strings"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -16,22 +19,94 @@ import (
 	"github.com/tobiashort/choose-go"
 	"github.com/tobiashort/clap-go"
 
-	. "github.com/tobiashort/cosine-similarity-go"
 	. "github.com/tobiashort/utils-go/must"
 )
 
 const (
 	hardTimeoutTest       = "Hard timeout"
 	inactivityTimeoutTest = "Inactivity timeout"
+	combinedTimeoutTest   = "Hard and inactivity timeout"
+	sessionFixationTest   = "Session fixation"
+	passwordChangeTest    = "Session invalidation after password change"
+	sessionBindingTest    = "Session binding"
+	refreshTokenTest      = "Refresh token lifetime and rotation"
+	rememberMeTest        = "Remember me persistent login"
+	webSocketTest         = "WebSocket connection timeout"
 )
 
+const (
+	pastedCommandSource = "Pasted command (curl, fetch, PowerShell, HTTPie)"
+	harFileSource       = "HAR file"
+	burpItemSource      = "Burp Suite saved item"
+	rawRequestSource    = "Raw HTTP request file"
+)
+
+var requestSources = []string{
+	pastedCommandSource,
+	harFileSource,
+	burpItemSource,
+	rawRequestSource,
+}
+
 type Args struct {
-	Interval time.Duration `clap:"description='Timeout interval in minutes (default: 5min for hard timeout, 15min for inactivity timeout).'"`
+	Interval           time.Duration `clap:"description='Timeout interval in minutes (default: 5min for hard timeout, 15min for inactivity timeout, 1h for remember me).'"`
+	Threshold          float64       `clap:"default-value=0.9,description='Minimum similarity to the reference response for a probe to count as authenticated.'"`
+	CookieJar          bool          `clap:"description='Apply Set-Cookie updates from each probe to subsequent probes.'"`
+	StaleCookies       bool          `clap:"short=,description='Replay the original cookies after each rotation to check whether stale cookies are still accepted (requires --cookie-jar, the replay may end the session).'"`
+	Proxy              string        `clap:"description='Upstream proxy for all requests (http://, https://, socks5:// or socks5h://).'"`
+	CaCert             string        `clap:"short=,description='PEM file with additional CA certificates to trust.'"`
+	Insecure           bool          `clap:"short=k,description='Do not verify the TLS certificate of the target.'"`
+	ClientCert         string        `clap:"short=,description='PEM file with the client certificate for mutual TLS.'"`
+	ClientKey          string        `clap:"short=,description='PEM file with the client key for mutual TLS.'"`
+	Dashboard          bool          `clap:"description='Show a live dashboard with countdown and probe timeline during the test.'"`
+	NotifyWebhook      []string      `clap:"short=,description='Webhook URL that receives every notification as JSON.'"`
+	NotifyChat         []string      `clap:"short=,description='Slack or Teams incoming webhook URL that receives every notification.'"`
+	NotifyEmail        []string      `clap:"short=,description='Email address that receives every notification (requires --smtp-server and --smtp-from).'"`
+	SmtpServer         string        `clap:"short=,description='SMTP server as host:port for email notifications.'"`
+	SmtpFrom           string        `clap:"short=,description='Sender address for email notifications.'"`
+	SmtpUser           string        `clap:"short=,description='SMTP user for email notifications (password is read from WYLMO_SMTP_PASSWORD).'"`
+	NotifyCommand      string        `clap:"short=,description='Shell command to run for every notification (event JSON on stdin and WYLMO_* variables).'"`
+	Output             string        `clap:"description='Directory for the results of this run (default: runs/<target-host>/<test>-<timestamp>).'"`
+	InconclusiveStreak int           `clap:"short=,default-value=3,description='Number of inconclusive probes in a row that triggers a notification.'"`
+	Redact             []string      `clap:"short=,description='Regular expression for additional secrets to mask in everything written or printed (masks the first group if there is one).'"`
+	Schedule           string        `clap:"short=,description='Inactivity schedule: linear:<step>, geometric:<start>[,<factor>] or list:<wait>,<wait>,... (default: linear with --interval).'"`
+	ScheduleFile       string        `clap:"short=,description='JSON file with the inactivity schedule (type, step, start, factor, waits, max_total).'"`
+	MaxTotal           time.Duration `clap:"short=,description='Stop the inactivity schedule before the accumulated waiting exceeds this duration.'"`
+	PreAuthUrl         string        `clap:"short=,description='URL that issues the pre-authentication session cookie for the session fixation test (default: URL of the --login request).'"`
+	PasswordChange     string        `clap:"short=,description='File with the password change request (curl, fetch, PowerShell or HTTPie command), sent with the session of a fresh login.'"`
+	PasswordChangeBack string        `clap:"short=,description='File with the request that changes the password back after the test.'"`
+	InvalidationWindow time.Duration `clap:"short=,default-value=5m,description='How long to probe the other session after the password change.'"`
+	BindingProxy       string        `clap:"short=,description='Alternative proxy with a different egress IP for the session binding test.'"`
+	TokenRequest       string        `clap:"short=,description='File with the token endpoint request (curl, fetch, PowerShell or HTTPie command) that exchanges a refresh_token.'"`
+	RefreshEvery       time.Duration `clap:"short=,description='Exchange the refresh token at this fixed interval to measure its absolute lifetime (default: follow the inactivity schedule).'"`
+	KeepRefreshToken   bool          `clap:"short=,description='Keep exchanging the original refresh token even if the server rotates it.'"`
+	RememberMeCookie   string        `clap:"short=,description='Name of the remember-me cookie, the only cookie sent in the remember me test (default: the only cookie of the request).'"`
+	WsUrl              string        `clap:"short=,description='WebSocket URL for the WebSocket test (default: URL of the request with ws:// or wss://).'"`
+	WsMessage          string        `clap:"short=,description='Message to send on the WebSocket every --interval (default: keep the connection idle).'"`
+	WsLoggedOut        string        `clap:"short=,description='Regular expression that marks a WebSocket message as unauthenticated; without it only close and drop end the test.'"`
+	StreamUrl          string        `clap:"short=,description='SSE or long-poll URL to hold open with the session credentials during the hard and inactivity timeout tests.'"`
+	IdpHost            []string      `clap:"short=,description='Host pattern of the identity provider (e.g. *.okta.com); probes then follow redirects and report application and IdP session expiry separately.'"`
+	IdpCookie          []string      `clap:"short=,description='IdP session cookies as host=name=value; name=value, sent when a probe is redirected to the IdP.'"`
+	Roles              string        `clap:"short=,description='JSON run definition with several roles (name, request, login, max_timeout) to run the hard or inactivity timeout test for concurrently.'"`
+	Endpoints          string        `clap:"short=,description='JSON file with further probe requests (name, request, threshold, logged_out_status, logged_out_pattern) that share the session in the hard and inactivity timeout tests.'"`
+	IdleSessions       int           `clap:"short=,default-value=1,description='Number of idle sessions that measure the inactivity timeout in the combined test.'"`
+	Trials             int           `clap:"short=,default-value=1,description='Number of times to repeat the test, logging in again with --login after each observed logout.'"`
+	Login              string        `clap:"short=,description='File with the login request (curl, fetch, PowerShell or HTTPie command) that returns a fresh session.'"`
+	LoginToken         string        `clap:"short=,description='Regular expression whose first group extracts a bearer token from the login response.'"`
+	ReplayKey          string        `clap:"short=,description='Key file for an encrypted unredacted copy of the request (curl_command.enc), created if missing. Use wylmo unredact to read it.'"`
 }
 
 var (
 	intervalArg       time.Duration
-	referenceResponse string
+	thresholdArg      float64
+	cookieJarArg      bool
+	staleCookiesArg   bool
+	dashboardArg      bool
+	outputArg         string
+	idleSessionsArg   int
+	referenceResponse Response
+	console           io.Writer = os.Stdout
+	dashboard         *Dashboard
 	startTime         = time.Now()
 )
 
@@ -51,171 +126,429 @@ func formatTime(t time.Time) string {
 	return fmt.Sprintf("%s +%s", t.Format("2006-01-02 15-04-05"), elapsed)
 }
 
-func requestCurlCommand() string {
-	fmt.Println("Please enter the curl command and accept with Ctrl-D.")
+func requestPastedCommand() (string, Request) {
+	fmt.Println("Please enter the curl, fetch, PowerShell or HTTPie command and accept with Ctrl-D.")
 	cfmt.Begin(ansi.DecorPurple)
-	curlCommand := readMultiLine()
+	command := readMultiLine()
 	cfmt.End()
-	if !strings.HasPrefix(curlCommand, "curl ") {
-		cfmt.Printf("#r{Not a curl command: %v\n}", curlCommand)
-		return requestCurlCommand()
-	}
-	fmt.Println("Testing curl command...")
-	cmd := exec.Command("bash", "-c", curlCommand)
-	outBytes, err := cmd.CombinedOutput()
-	output := string(outBytes)
-	output = strings.TrimSpace(output)
+	format, ok := detectCommandFormat(command)
+	if !ok {
+		cfmt.Printf("#r{Not a supported command: %v\n}", command)
+		return requestPastedCommand()
+	}
+	cfmt.Printf("Detected #yB{'%s'} command\n", format)
+	req, err := parseCommand(format, command)
 	if err != nil {
-		cfmt.Println("#r{Curl command failed}")
+		cfmt.Printf("#r{Cannot parse %s command}\n", format)
 		cfmt.CPrintln(ansi.DecorRed, err.Error())
-		if output != "" {
-			cfmt.CPrintln(ansi.DecorRed, (output))
+		return requestPastedCommand()
+	}
+	if reviewReference(req) {
+		if format == curlFormat {
+			return command, req
 		}
-		return requestCurlCommand()
+		return req.CurlCommand(), req
 	}
-	fmt.Println("Curl command was successful.")
-	fmt.Printf("Please hit enter to review the curl command's output before continuing.")
+	return requestPastedCommand()
+}
+
+func reviewReference(req Request) bool {
+	addRequestSecrets(req)
+	fmt.Println("Testing request...")
+	resp, err := sendRequest(context.Background(), req)
+	if err != nil {
+		cfmt.Println("#r{Request failed}")
+		cfmt.CPrintln(ansi.DecorRed, err.Error())
+		return false
+	}
+	fmt.Println("Request was successful.")
+	fmt.Printf("Please hit enter to review the response before continuing.")
 	readLine()
-	cmd = exec.Command("more")
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	writer := Must2(cmd.StdinPipe())
-	Must(cmd.Start())
-	Must2(writer.Write(outBytes))
-	Must(writer.Close())
-	Must(cmd.Wait())
-	if choose.YesNo("Is the curl command's output ok?", choose.DEFAULT_NONE) {
-		referenceResponse = string(outBytes)
-		return curlCommand
-	}
-	return requestCurlCommand()
-}
-
-func performHardTimeoutTest(curlCommand string) {
-	cfmt.Printf("Performing #yB{'%s'} test...\n", hardTimeoutTest)
-	if _, err := os.Stat("hard_timeout"); err == nil {
-		if choose.YesNo("Remove previous test results?", choose.DEFAULT_NONE) {
-			Must(os.RemoveAll("hard_timeout"))
-		} else {
-			fmt.Printf("Abort.\n")
-			os.Exit(1)
-		}
+	runPager(1, 0, func(int) (string, []string) {
+		return "Response", splitLines(redact(resp.Text()))
+	})
+	if choose.YesNo("Is the response ok?", choose.DEFAULT_NONE) {
+		referenceResponse = resp
+		return true
 	}
-	Must(os.Mkdir("hard_timeout", 0755))
-	Must(os.WriteFile("hard_timeout/curl_command", []byte(curlCommand), 0644))
-	logFile := Must2(os.OpenFile("hard_timeout/log", os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0644))
-	defer logFile.Close()
-	interval := intervalArg
-	if interval == 0 {
-		interval = 5 * time.Minute
+	return false
+}
+
+func probe(ctx context.Context, run *Run, req Request, jar *CookieJar, waited time.Duration) bool {
+	probeReq := jar.Apply(req)
+	resp, err := sendRequestWith(ctx, newProbeClient(probeReq), probeReq)
+	if ctx.Err() != nil {
+		return false
 	}
-	cfmt.Printf("Interval is set to #yB{'%v'}\n", interval)
-	startTime = time.Now()
+	now := time.Now()
+	result := ProbeResult{Time: now, Elapsed: now.Sub(startTime), Waited: waited, Verdict: verdictInconclusive}
+	if err != nil {
+		result.Error = redact(err.Error())
+	} else {
+		jar.Update(resp, now)
+		result.Status = resp.StatusCode
+		result.Redirects = redactRedirects(resp.Redirects)
+		result.Similarity = similarityTo(run.reference, resp)
+		result.Verdict = verdictFor(result.Similarity)
+	}
+	run.Record(result, resp)
+	if staleCookiesArg && jar.Rotated() {
+		probeStaleCookies(ctx, run, req)
+	}
+	for _, endpoint := range run.endpoints {
+		endpoint.probe(ctx, jar, waited)
+	}
+	return true
+}
+
+func probeStaleCookies(ctx context.Context, run *Run, req Request) {
+	resp, err := sendRequest(ctx, req)
+	if ctx.Err() != nil {
+		return
+	}
+	now := time.Now()
+	result := StaleCookieResult{Time: now, Verdict: verdictInconclusive}
+	if err == nil {
+		result.Status = resp.StatusCode
+		result.Similarity = similarityTo(run.reference, resp)
+		result.Verdict = verdictFor(result.Similarity)
+	}
+	switch result.Verdict {
+	case verdictLoggedOut:
+		result.Finding = "stale cookies are rejected, the app enforces rotation"
+	case verdictAuthenticated:
+		result.Finding = "stale cookies are still accepted, the app does not enforce rotation"
+	default:
+		result.Finding = "stale cookies could not be tested: " + redact(err.Error())
+	}
+	cfmt.Fprintf(console, "%v #bB{stale} %s\n", formatTime(now), colorByVerdict(result.Verdict, result.Finding))
+	Must2(fmt.Fprintf(run.logFile, "%v stale %s\n", formatTime(now), result.Finding))
+	run.state.StaleCookies = append(run.state.StaleCookies, result)
+	run.save()
+}
+
+func startSession(dir string, typeOfTest string, curlCommand string, req Request, reference Response) (*Run, *CookieJar) {
+	writeRequest(dir, curlCommand, req)
+	writeResponse(dir, "reference", reference)
+	jar := newCookieJar(req, filepath.Join(dir, "cookie_rotations"))
+	jar.Update(reference, time.Now())
+	run := newRun(dir, typeOfTest)
+	run.reference = reference
+	return run, jar
+}
+
+func hardTimeoutInterval() time.Duration {
+	if intervalArg == 0 {
+		return 5 * time.Minute
+	}
+	return intervalArg
+}
+
+func inactivityTimeoutStep() time.Duration {
+	if intervalArg == 0 {
+		return 15 * time.Minute
+	}
+	return intervalArg
+}
+
+func hardTimeoutLoop(ctx context.Context, run *Run, req Request, jar *CookieJar, interval time.Duration) {
 	for {
-		cmd := exec.Command("bash", "-c", curlCommand)
-		bytesOut, err := cmd.CombinedOutput()
-		output := string(bytesOut)
-		if err != nil {
-			output = err.Error() + "\n" + output
+		probe(ctx, run, req, jar, 0)
+		if run.Done() {
+			return
 		}
-		now := time.Now()
-		if err != nil {
-			curlLogFile := fmt.Sprintf("hard_timeout/%v", formatTime(now))
-			Must(os.WriteFile(curlLogFile, []byte(output), 0644))
-			cfmt.Printf("%v #r{%s}\n", formatTime(now), output)
-			Must2(fmt.Fprintf(logFile, "%v %s\n", formatTime(now), output))
-		} else {
-			similarity := CosineSimilarity(referenceResponse, output)
-			curlLogFile := fmt.Sprintf("hard_timeout/%v %f similarity", formatTime(now), similarity)
-			Must(os.WriteFile(curlLogFile, []byte(output), 0644))
-			cfmt.Printf("%v #yB{%f} similarity\n", formatTime(now), similarity)
-			Must2(fmt.Fprintf(logFile, "%v %f similarity\n", formatTime(now), similarity))
+		if _, ok := wait(ctx, interval); !ok {
+			return
 		}
-		time.Sleep(interval)
 	}
 }
 
-func performInactivityTimeoutTest(curlCommand string) {
-	cfmt.Printf("Performing #yB{'%s'} test...\n", inactivityTimeoutTest)
-	if _, err := os.Stat("inactivity_timeout"); err == nil {
-		if choose.YesNo("Remove previous test results?", choose.DEFAULT_NONE) {
-			Must(os.RemoveAll("inactivity_timeout"))
-		} else {
-			fmt.Printf("Abort.\n")
-			os.Exit(1)
+func inactivityTimeoutLoop(ctx context.Context, run *Run, req Request, jar *CookieJar, waits iter.Seq[time.Duration]) {
+	for interval := range waits {
+		if !run.Proceed(interval) {
+			return
 		}
-	}
-	Must(os.Mkdir("inactivity_timeout", 0755))
-	Must(os.WriteFile("inactivity_timeout/curl_command", []byte(curlCommand), 0644))
-	logFile := Must2(os.OpenFile("inactivity_timeout/log", os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0644))
-	defer logFile.Close()
-	interval := 0 * time.Minute
-	startTime = time.Now()
-	for {
-		cfmt.Printf("Waiting for #yB{'%v'}\n", interval)
-		time.Sleep(interval)
-		cmd := exec.Command("bash", "-c", curlCommand)
-		bytesOut, err := cmd.CombinedOutput()
-		output := string(bytesOut)
-		if err != nil {
-			output = err.Error() + "\n" + output
+		cfmt.Fprintf(console, "%sWaiting for #yB{'%v'}\n", run.prefix(), interval)
+		waited, ok := wait(ctx, interval)
+		if !ok {
+			return
 		}
-		now := time.Now()
-		if err != nil {
-			curlLogFile := fmt.Sprintf("inactivity_timeout/%v", formatTime(now))
-			Must(os.WriteFile(curlLogFile, []byte(output), 0644))
-			cfmt.Printf("%v #r{%s}\n", formatTime(now), output)
-			Must2(fmt.Fprintf(logFile, "%v %s\n", formatTime(now), output))
-		} else {
-			similarity := CosineSimilarity(referenceResponse, output)
-			curlLogFile := fmt.Sprintf("inactivity_timeout/%v %f similarity", formatTime(now), similarity)
-			Must(os.WriteFile(curlLogFile, []byte(output), 0644))
-			cfmt.Printf("%v #yB{%f} similarity\n", formatTime(now), similarity)
-			Must2(fmt.Fprintf(logFile, "%v %f similarity\n", formatTime(now), similarity))
+		if !probe(ctx, run, req, jar, waited) || run.Done() {
+			return
 		}
-		if intervalArg == 0 {
-			interval += 15 * time.Minute
-		} else {
-			interval += intervalArg
+	}
+}
+
+func performHardTimeoutTest(ctx context.Context, dir string, curlCommand string, req Request) *Run {
+	cfmt.Printf("Performing #yB{'%s'} test...\n", hardTimeoutTest)
+	interval := hardTimeoutInterval()
+	cfmt.Printf("Interval is set to #yB{'%v'}\n", interval)
+	startTime = time.Now()
+	run, jar := startSession(dir, hardTimeoutTest, curlCommand, req, referenceResponse)
+	defer jar.Close()
+	defer run.Finish(ctx)
+	startStream(ctx, run, req)
+	startEndpoints(ctx, run, req)
+	hardTimeoutLoop(ctx, run, req, jar, interval)
+	return run
+}
+
+func performInactivityTimeoutTest(ctx context.Context, dir string, curlCommand string, req Request) *Run {
+	cfmt.Printf("Performing #yB{'%s'} test...\n", inactivityTimeoutTest)
+	cfmt.Printf("Schedule is #yB{'%v'}\n", schedule)
+	cfmt.Printf("Projected test time is #yB{%s}\n", schedule.Projection(0, 1))
+	startTime = time.Now()
+	run, jar := startSession(dir, inactivityTimeoutTest, curlCommand, req, referenceResponse)
+	defer jar.Close()
+	defer run.Finish(ctx)
+	startStream(ctx, run, req)
+	startEndpoints(ctx, run, req)
+	waits := func(yield func(time.Duration) bool) {
+		if yield(0) {
+			schedule.Waits(0, 1)(yield)
 		}
 	}
+	inactivityTimeoutLoop(ctx, run, req, jar, waits)
+	return run
+}
+
+func wait(ctx context.Context, interval time.Duration) (time.Duration, bool) {
+	if dashboard != nil {
+		return dashboard.Wait(ctx, interval)
+	}
+	start := time.Now()
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return time.Since(start).Round(time.Millisecond), false
+	case <-timer.C:
+		return time.Since(start).Round(time.Millisecond), true
+	}
 }
 
-func performTest(typeOfTest string, curlCommand string) {
+func performTest(ctx context.Context, typeOfTest string, curlCommand string, req Request) {
+	if trialsArg > 1 && typeOfTest != hardTimeoutTest && typeOfTest != inactivityTimeoutTest {
+		cfmt.Printf("#r{--trials is not supported for the '%s' test}\n", typeOfTest)
+		return
+	}
+	if (typeOfTest == sessionFixationTest || typeOfTest == passwordChangeTest) && loginRequest.URL == "" {
+		cfmt.Printf("#r{The '%s' test requires --login}\n", typeOfTest)
+		return
+	}
+	if typeOfTest == passwordChangeTest && passwordChangeRequest.URL == "" {
+		cfmt.Printf("#r{The '%s' test requires --password-change}\n", typeOfTest)
+		return
+	}
+	if typeOfTest == refreshTokenTest && tokenRequest.URL == "" {
+		cfmt.Printf("#r{The '%s' test requires --token-request}\n", typeOfTest)
+		return
+	}
+	if dashboardArg && (typeOfTest == combinedTimeoutTest || typeOfTest == webSocketTest) {
+		cfmt.Printf("#y{The dashboard is not available for the '%s' test}\n", typeOfTest)
+	} else if dashboardArg {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithCancel(ctx)
+		defer cancel()
+		dashboard = newDashboard(typeOfTest, cancel)
+		console = dashboard
+		defer dashboard.Close()
+	}
+	dir, err := createRunDir(typeOfTest, req)
+	if err != nil {
+		cfmt.Fprintf(console, "#r{Cannot create run directory: %s}\n", err.Error())
+		return
+	}
+	cfmt.Fprintf(console, "Results are written to #yB{'%s'}\n", dir)
+	if typeOfTest == combinedTimeoutTest {
+		performCombinedTest(ctx, dir, curlCommand, req)
+		return
+	}
+	if trialsArg > 1 {
+		performTrials(ctx, typeOfTest, dir, curlCommand, req)
+		return
+	}
+	performSingleTest(ctx, typeOfTest, dir, curlCommand, req)
+}
+
+func performSingleTest(ctx context.Context, typeOfTest string, dir string, curlCommand string, req Request) *Run {
 	switch typeOfTest {
 	case hardTimeoutTest:
-		performHardTimeoutTest(curlCommand)
+		return performHardTimeoutTest(ctx, dir, curlCommand, req)
 	case inactivityTimeoutTest:
-		performInactivityTimeoutTest(curlCommand)
+		return performInactivityTimeoutTest(ctx, dir, curlCommand, req)
+	case sessionFixationTest:
+		return performSessionFixationTest(ctx, dir, curlCommand, req)
+	case passwordChangeTest:
+		return performPasswordChangeTest(ctx, dir, curlCommand, req)
+	case sessionBindingTest:
+		return performSessionBindingTest(ctx, dir, curlCommand, req)
+	case refreshTokenTest:
+		return performRefreshTokenTest(ctx, dir, curlCommand, req)
+	case rememberMeTest:
+		return performRememberMeTest(ctx, dir, curlCommand, req)
+	case webSocketTest:
+		return performWebSocketTest(ctx, dir, curlCommand, req)
 	default:
 		panic("Unknown test to perform: " + typeOfTest)
 	}
 }
 
+func requestFromSource(source string) (string, Request) {
+	switch source {
+	case pastedCommandSource:
+		return requestPastedCommand()
+	case harFileSource:
+		return requestHARFile()
+	case burpItemSource:
+		return requestBurpItem()
+	case rawRequestSource:
+		return requestRawHTTPFile()
+	default:
+		panic("Unknown request source: " + source)
+	}
+}
+
 func main() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	testRunning := atomic.Bool{}
 	sigs := make(chan os.Signal, 1)
 	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
 	go func() {
-		<-sigs
-		fmt.Print(ansi.DecorReset)
-		fmt.Printf("\nAbort.\n")
-		os.Exit(1)
+		for range sigs {
+			fmt.Print(ansi.DecorReset)
+			if testRunning.Load() && ctx.Err() == nil {
+				fmt.Printf("\nStopping...\n")
+				cancel()
+				continue
+			}
+			fmt.Printf("\nAbort.\n")
+			os.Exit(1)
+		}
 	}()
 
+	if len(os.Args) > 1 {
+		subcommands := map[string]func(){
+			"diff":     diffCommand,
+			"export":   exportCommand,
+			"verify":   verifyCommand,
+			"unredact": unredactCommand,
+		}
+		if subcommand, ok := subcommands[os.Args[1]]; ok {
+			os.Args = append(os.Args[:1], os.Args[2:]...)
+			subcommand()
+			return
+		}
+	}
+
 	cfmt.Println("Welcome to #yB{wylmo}!")
 
 	args := Args{}
 	clap.Parse(&args)
 	intervalArg = args.Interval
+	thresholdArg = args.Threshold
+	cookieJarArg = args.CookieJar
+	staleCookiesArg = args.StaleCookies
+	if staleCookiesArg && !cookieJarArg {
+		cfmt.Println("#r{--stale-cookies requires --cookie-jar}")
+		os.Exit(1)
+	}
+	dashboardArg = args.Dashboard
+	outputArg = args.Output
+	idleSessionsArg = max(args.IdleSessions, 1)
+	preAuthURLArg = args.PreAuthUrl
+	rememberMeCookieArg = args.RememberMeCookie
+	streamURLArg = args.StreamUrl
+	if err := configureTransport(args); err != nil {
+		cfmt.Printf("#r{%s}\n", err.Error())
+		os.Exit(1)
+	}
+	if err := configureNotifications(args); err != nil {
+		cfmt.Printf("#r{%s}\n", err.Error())
+		os.Exit(1)
+	}
+	if err := configureRedaction(args); err != nil {
+		cfmt.Printf("#r{%s}\n", err.Error())
+		os.Exit(1)
+	}
+	if err := configureSchedule(args); err != nil {
+		cfmt.Printf("#r{%s}\n", err.Error())
+		os.Exit(1)
+	}
+	if err := configureTrials(args); err != nil {
+		cfmt.Printf("#r{%s}\n", err.Error())
+		os.Exit(1)
+	}
+	if err := configurePasswordChange(args); err != nil {
+		cfmt.Printf("#r{%s}\n", err.Error())
+		os.Exit(1)
+	}
+	if err := configureBinding(args); err != nil {
+		cfmt.Printf("#r{%s}\n", err.Error())
+		os.Exit(1)
+	}
+	if err := configureRefresh(args); err != nil {
+		cfmt.Printf("#r{%s}\n", err.Error())
+		os.Exit(1)
+	}
+	if err := configureWebSocket(args); err != nil {
+		cfmt.Printf("#r{%s}\n", err.Error())
+		os.Exit(1)
+	}
+	if err := configureSSO(args); err != nil {
+		cfmt.Printf("#r{%s}\n", err.Error())
+		os.Exit(1)
+	}
+	if err := configureEndpoints(args); err != nil {
+		cfmt.Printf("#r{%s}\n", err.Error())
+		os.Exit(1)
+	}
+
+	if args.Roles != "" {
+		definition, err := loadRoleDefinition(args.Roles)
+		if err != nil {
+			cfmt.Printf("#r{%s}\n", err.Error())
+			os.Exit(1)
+		}
+		typeOfTest := definition.Test
+		if typeOfTest == "" {
+			var ok bool
+			typeOfTest, ok = choose.One("Please choose the type of test to perform", []string{
+				hardTimeoutTest,
+				inactivityTimeoutTest,
+			})
+			if !ok {
+				fmt.Println("Abort.")
+				return
+			}
+		}
+		testRunning.Store(true)
+		performRoleComparison(ctx, typeOfTest, definition)
+		return
+	}
 
 	typeOfTest, ok := choose.One("Please choose the type of test to perform", []string{
 		hardTimeoutTest,
 		inactivityTimeoutTest,
+		combinedTimeoutTest,
+		sessionFixationTest,
+		passwordChangeTest,
+		sessionBindingTest,
+		refreshTokenTest,
+		rememberMeTest,
+		webSocketTest,
 	})
 	if ok {
 		cfmt.Printf("Thank you for choosing #yB{'%s'}\n", typeOfTest)
-		curlCommand := requestCurlCommand()
-		performTest(typeOfTest, curlCommand)
+		source, ok := choose.One("Please choose where to load the request from", requestSources)
+		if !ok {
+			fmt.Println("Abort.")
+			return
+		}
+		curlCommand, req := requestFromSource(source)
+		testRunning.Store(true)
+		performTest(ctx, typeOfTest, curlCommand, req)
 	} else {
 		fmt.Println("Abort.")
 	}
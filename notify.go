@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/tobiashort/cfmt-go"
+)
+
+const (
+	eventLogoutDetected     = "logout_detected"
+	eventInconclusiveStreak = "inconclusive_streak"
+	eventRunFinished        = "run_finished"
+	eventError              = "error"
+)
+
+const notifyTimeout = 10 * time.Second
+
+type Notification struct {
+	Event   string    `json:"event"`
+	Test    string    `json:"test"`
+	Time    time.Time `json:"time"`
+	Message string    `json:"message"`
+	Verdict string    `json:"verdict"`
+	RunDir  string    `json:"run_dir"`
+}
+
+type notifier struct {
+	name string
+	send func(Notification) error
+}
+
+var (
+	notifiers             = make([]notifier, 0)
+	inconclusiveStreakArg int
+)
+
+func configureNotifications(args Args) error {
+	inconclusiveStreakArg = args.InconclusiveStreak
+	for _, url := range args.NotifyWebhook {
+		notifiers = append(notifiers, notifier{"webhook " + webhookName(url), func(n Notification) error {
+			return postJSON(url, n)
+		}})
+	}
+	for _, url := range args.NotifyChat {
+		notifiers = append(notifiers, notifier{"chat " + webhookName(url), func(n Notification) error {
+			return postJSON(url, map[string]string{"text": fmt.Sprintf("[wylmo] %s: %s", n.Test, n.Message)})
+		}})
+	}
+	if len(args.NotifyEmail) > 0 {
+		if args.SmtpServer == "" || args.SmtpFrom == "" {
+			return fmt.Errorf("--notify-email requires --smtp-server and --smtp-from")
+		}
+		notifiers = append(notifiers, notifier{"email", func(n Notification) error {
+			return sendMail(args.SmtpServer, args.SmtpFrom, args.SmtpUser, args.NotifyEmail, n)
+		}})
+	}
+	if args.NotifyCommand != "" {
+		notifiers = append(notifiers, notifier{"command", func(n Notification) error {
+			return runNotifyCommand(args.NotifyCommand, n)
+		}})
+	}
+	return nil
+}
+
+// webhookName registers everything after the host of a webhook URL as a
+// secret, since chat webhooks carry their token in the path, and returns the
+// URL in its redacted form.
+func webhookName(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		addSecret(raw)
+		return redact(raw)
+	}
+	addSecret(strings.TrimPrefix(raw, u.Scheme+"://"+u.Host+"/"))
+	return redact(raw)
+}
+
+func notify(event string, test string, dir string, message string, verdict string) {
+	n := Notification{
+		Event:   event,
+		Test:    test,
+		Time:    time.Now(),
+		Message: redact(message),
+		Verdict: verdict,
+		RunDir:  dir,
+	}
+	for _, notifier := range notifiers {
+		if err := notifier.send(n); err != nil {
+			cfmt.Fprintf(console, "#r{Notification via %s failed: %s}\n", notifier.name, redact(err.Error()))
+		}
+	}
+}
+
+func postJSON(url string, payload any) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+func sendMail(server string, from string, user string, to []string, n Notification) error {
+	var auth smtp.Auth
+	if user != "" {
+		host, _, err := net.SplitHostPort(server)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", user, os.Getenv("WYLMO_SMTP_PASSWORD"), host)
+	}
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %s\r\n", from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&msg, "Subject: [wylmo] %s: %s\r\n", n.Test, n.Message)
+	fmt.Fprintf(&msg, "Date: %s\r\n", n.Time.Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	fmt.Fprintf(&msg, "Event:   %s\r\n", n.Event)
+	fmt.Fprintf(&msg, "Test:    %s\r\n", n.Test)
+	fmt.Fprintf(&msg, "Time:    %s\r\n", n.Time.Format(time.RFC3339))
+	fmt.Fprintf(&msg, "Run:     %s\r\n", n.RunDir)
+	fmt.Fprintf(&msg, "Message: %s\r\n", n.Message)
+	fmt.Fprintf(&msg, "Verdict: %s\r\n", n.Verdict)
+	done := make(chan error, 1)
+	go func() {
+		done <- smtp.SendMail(server, auth, from, to, []byte(msg.String()))
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(notifyTimeout):
+		return fmt.Errorf("timeout after %v", notifyTimeout)
+	}
+}
+
+func runNotifyCommand(command string, n Notification) error {
+	data, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "bash", "-c", command)
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Env = append(os.Environ(),
+		"WYLMO_EVENT="+n.Event,
+		"WYLMO_TEST="+n.Test,
+		"WYLMO_MESSAGE="+n.Message,
+		"WYLMO_VERDICT="+n.Verdict,
+		"WYLMO_RUN_DIR="+n.RunDir,
+	)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func withNotifiers(t *testing.T, args Args) *bytes.Buffer {
+	t.Helper()
+	var output bytes.Buffer
+	notifiers, console = nil, &output
+	t.Cleanup(func() { notifiers, console = nil, os.Stdout })
+	if err := configureNotifications(args); err != nil {
+		t.Fatal(err)
+	}
+	return &output
+}
+
+func TestNotifyWebhook(t *testing.T) {
+	received := make(chan []byte, 2)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		received <- data
+	}))
+	defer server.Close()
+	withNotifiers(t, Args{
+		NotifyWebhook: []string{server.URL + "/webhook"},
+		NotifyChat:    []string{server.URL + "/chat"},
+	})
+	notify(eventLogoutDetected, hardTimeoutTest, "runs/example", "Logout detected", verdictLoggedOut)
+
+	n := Notification{}
+	if err := json.Unmarshal(<-received, &n); err != nil {
+		t.Fatal(err)
+	}
+	if n.Event != eventLogoutDetected || n.Test != hardTimeoutTest || n.RunDir != "runs/example" || n.Verdict != verdictLoggedOut {
+		t.Errorf("unexpected webhook payload: %+v", n)
+	}
+	chat := map[string]string{}
+	if err := json.Unmarshal(<-received, &chat); err != nil {
+		t.Fatal(err)
+	}
+	if want := "[wylmo] " + hardTimeoutTest + ": Logout detected"; chat["text"] != want {
+		t.Errorf("chat text = %q; want %q", chat["text"], want)
+	}
+}
+
+func TestNotifyFailureRedactsWebhookURL(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+	token := "T000/B000/XXXXXXXXXXXXXXXXXXXXXXXX"
+	output := withNotifiers(t, Args{NotifyChat: []string{server.URL + "/services/" + token}})
+	if strings.Contains(notifiers[0].name, token) {
+		t.Errorf("notifier name contains the webhook token: %s", notifiers[0].name)
+	}
+	notify(eventError, hardTimeoutTest, "runs/example", "failed", verdictInconclusive)
+	if !strings.Contains(output.String(), "failed") {
+		t.Fatalf("no failure was printed: %q", output.String())
+	}
+	if strings.Contains(output.String(), token) {
+		t.Errorf("failure output contains the webhook token: %s", output.String())
+	}
+}
+
+// fakeSMTPServer accepts a single mail and returns its DATA section.
+func fakeSMTPServer(t *testing.T) (string, <-chan string) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	data := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		reader := bufio.NewReader(conn)
+		reply := func(line string) { io.WriteString(conn, line+"\r\n") }
+		reply("220 localhost ESMTP")
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			switch command := strings.ToUpper(strings.Fields(line)[0]); command {
+			case "EHLO", "HELO", "MAIL", "RCPT", "RSET", "NOOP":
+				reply("250 OK")
+			case "DATA":
+				reply("354 End data with <CR><LF>.<CR><LF>")
+				var message strings.Builder
+				for {
+					line, err := reader.ReadString('\n')
+					if err != nil || line == ".\r\n" {
+						break
+					}
+					message.WriteString(line)
+				}
+				data <- message.String()
+				reply("250 OK")
+			case "QUIT":
+				reply("221 Bye")
+				return
+			default:
+				reply("502 Command not implemented")
+			}
+		}
+	}()
+	return listener.Addr().String(), data
+}
+
+func TestNotifyEmail(t *testing.T) {
+	server, data := fakeSMTPServer(t)
+	output := withNotifiers(t, Args{
+		NotifyEmail: []string{"alice@example.com"},
+		SmtpServer:  server,
+		SmtpFrom:    "wylmo@example.com",
+	})
+	notify(eventRunFinished, inactivityTimeoutTest, "runs/example", "Run finished", verdictLoggedOut)
+	if output.Len() > 0 {
+		t.Fatalf("notification failed: %s", output.String())
+	}
+	message := <-data
+	for _, want := range []string{
+		"To: alice@example.com\r\n",
+		"Subject: [wylmo] " + inactivityTimeoutTest + ": Run finished\r\n",
+		"Event:   " + eventRunFinished + "\r\n",
+		"Verdict: " + verdictLoggedOut + "\r\n",
+	} {
+		if !strings.Contains(message, want) {
+			t.Errorf("mail does not contain %q:\n%s", want, message)
+		}
+	}
+}
+
+func TestNotifyEmailRequiresServer(t *testing.T) {
+	t.Cleanup(func() { notifiers = nil })
+	if err := configureNotifications(Args{NotifyEmail: []string{"alice@example.com"}}); err == nil {
+		t.Error("--notify-email without --smtp-server was accepted")
+	}
+}
+
+func TestNotifyCommand(t *testing.T) {
+	dir := t.TempDir()
+	stdin := filepath.Join(dir, "stdin")
+	env := filepath.Join(dir, "env")
+	withNotifiers(t, Args{NotifyCommand: `cat > "` + stdin + `"; echo "$WYLMO_EVENT $WYLMO_VERDICT" > "` + env + `"`})
+	notify(eventInconclusiveStreak, hardTimeoutTest, "runs/example", "3 inconclusive probes", verdictInconclusive)
+
+	data, err := os.ReadFile(stdin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := Notification{}
+	if err := json.Unmarshal(data, &n); err != nil {
+		t.Fatal(err)
+	}
+	if n.Event != eventInconclusiveStreak || n.Message != "3 inconclusive probes" {
+		t.Errorf("unexpected event on stdin: %+v", n)
+	}
+	data, err = os.ReadFile(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := eventInconclusiveStreak + " " + verdictInconclusive + "\n"; string(data) != want {
+		t.Errorf("environment = %q; want %q", data, want)
+	}
+}
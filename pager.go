@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/tobiashort/ansi-go"
+	. "github.com/tobiashort/utils-go/must"
+
+	"golang.org/x/term"
+)
+
+func visibleWidth(s string) int {
+	width := 0
+	escape := false
+	for _, r := range s {
+		switch {
+		case r == '\033':
+			escape = true
+		case escape:
+			if r == 'm' {
+				escape = false
+			}
+		default:
+			width++
+		}
+	}
+	return width
+}
+
+func truncateLine(s string, width int) string {
+	s = strings.ReplaceAll(s, "\t", "    ")
+	if visibleWidth(s) <= width {
+		return s
+	}
+	var b strings.Builder
+	visible := 0
+	escape := false
+	for _, r := range s {
+		switch {
+		case r == '\033':
+			escape = true
+			b.WriteRune(r)
+		case escape:
+			if r == 'm' {
+				escape = false
+			}
+			b.WriteRune(r)
+		case visible < width-1:
+			visible++
+			b.WriteRune(r)
+		}
+	}
+	return b.String() + "…" + ansi.DecorReset
+}
+
+func padLine(s string, width int) string {
+	return truncateLine(s, width) + strings.Repeat(" ", max(width-visibleWidth(s), 0))
+}
+
+func runPager(count int, index int, render func(index int) (string, []string)) {
+	title, lines := render(index)
+	fd := int(os.Stdout.Fd())
+	if !term.IsTerminal(fd) || !term.IsTerminal(int(os.Stdin.Fd())) {
+		fmt.Println(title)
+		for _, line := range lines {
+			fmt.Println(line)
+		}
+		return
+	}
+	oldState := Must2(term.MakeRaw(int(os.Stdin.Fd())))
+	defer term.Restore(int(os.Stdin.Fd()), oldState)
+	fmt.Print(ansi.CursorHide)
+	defer fmt.Print(ansi.CursorShow, ansi.EraseEntireScreen, ansi.CursorMoveToHomePosition)
+
+	offset := 0
+	buf := make([]byte, 3)
+	for {
+		width, height := Must3(term.GetSize(fd))
+		pageSize := max(height-2, 1)
+		offset = max(min(offset, len(lines)-pageSize), 0)
+
+		fmt.Print(ansi.EraseEntireScreen, ansi.CursorMoveToHomePosition)
+		fmt.Print(ansi.DecorReversed, padLine(title, width), ansi.DecorReset, "\r\n")
+		for i := offset; i < min(offset+pageSize, len(lines)); i++ {
+			fmt.Print(truncateLine(lines[i], width), ansi.DecorReset, "\r\n")
+		}
+		for i := len(lines) - offset; i < pageSize; i++ {
+			fmt.Print("~\r\n")
+		}
+		status := fmt.Sprintf("lines %d-%d/%d", min(offset+1, len(lines)), min(offset+pageSize, len(lines)), len(lines))
+		if count > 1 {
+			status += fmt.Sprintf("  n/p: probe %d/%d", index+1, count)
+		}
+		status += "  ↑/↓ space/b: scroll  q: quit"
+		fmt.Print(ansi.DecorReversed, padLine(status, width), ansi.DecorReset)
+
+		n := Must2(os.Stdin.Read(buf))
+		switch string(buf[:n]) {
+		case ansi.InputKeyDown, "j", ansi.InputCR, ansi.InputLF:
+			offset++
+		case ansi.InputKeyUp, "k":
+			offset--
+		case ansi.InputSpace, "f":
+			offset += pageSize
+		case "b":
+			offset -= pageSize
+		case "g":
+			offset = 0
+		case "G":
+			offset = len(lines)
+		case "n", ansi.InputKeyRight:
+			if index < count-1 {
+				index++
+				title, lines = render(index)
+				offset = 0
+			}
+		case "p", ansi.InputKeyLeft:
+			if index > 0 {
+				index--
+				title, lines = render(index)
+				offset = 0
+			}
+		case "q", ansi.InputEscape, ansi.InputCtrlC:
+			return
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/tobiashort/cfmt-go"
+)
+
+var (
+	passwordChangeRequest     Request
+	passwordChangeBackRequest Request
+	invalidationWindowArg     time.Duration
+)
+
+func configurePasswordChange(args Args) error {
+	invalidationWindowArg = args.InvalidationWindow
+	var err error
+	if args.PasswordChange != "" {
+		passwordChangeRequest, err = readCommandFile(args.PasswordChange)
+		if err != nil {
+			return err
+		}
+		addRequestSecrets(passwordChangeRequest)
+	}
+	if args.PasswordChangeBack != "" {
+		passwordChangeBackRequest, err = readCommandFile(args.PasswordChangeBack)
+		if err != nil {
+			return err
+		}
+		addRequestSecrets(passwordChangeBackRequest)
+	}
+	return nil
+}
+
+func sendChange(ctx context.Context, run *Run, name string, change Request, session Request) (Response, error) {
+	resp, err := sendRequest(ctx, withSession(change, session))
+	if err != nil {
+		run.Note("%s request failed: %s", name, err.Error())
+		return resp, err
+	}
+	writeResponse(run.dir, name, resp)
+	run.Note("%s request returned %s", name, resp.Status)
+	if resp.StatusCode >= 400 {
+		return resp, fmt.Errorf("%s request returned %s", name, resp.Status)
+	}
+	return resp, nil
+}
+
+func changePasswordBack(run *Run, session Request) {
+	if passwordChangeBackRequest.URL == "" {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if _, err := sendChange(ctx, run, "password-change-back", passwordChangeBackRequest, session); err != nil {
+		cfmt.Fprintf(console, "#r{Changing the password back failed, please restore it manually}\n")
+	}
+}
+
+func performPasswordChangeTest(ctx context.Context, dir string, curlCommand string, req Request) *Run {
+	cfmt.Printf("Performing #yB{'%s'} test...\n", passwordChangeTest)
+	interval := intervalArg
+	if interval == 0 {
+		interval = 30 * time.Second
+	}
+	cfmt.Printf("Other session is probed every #yB{'%v'} for #yB{'%v'}\n", interval, invalidationWindowArg)
+	startTime = time.Now()
+	run := startFindingSession(dir, passwordChangeTest, curlCommand, req)
+	defer run.Finish(ctx)
+
+	changing, err := relogin(ctx, req)
+	if err != nil {
+		run.Conclude(findingInconclusive, "first session: %s", err.Error())
+		return run
+	}
+	other, err := relogin(ctx, req)
+	if err != nil {
+		run.Conclude(findingInconclusive, "second session: %s", err.Error())
+		return run
+	}
+	if sameSession(changing, other) {
+		run.Conclude(findingInconclusive, "both logins returned the same session")
+		return run
+	}
+	run.Note("Established two sessions via the login request")
+
+	if _, err := sendChange(ctx, run, "password-change", passwordChangeRequest, changing); err != nil {
+		run.Conclude(findingInconclusive, "%s", err.Error())
+		return run
+	}
+	changedAt := time.Now()
+	defer changePasswordBack(run, changing)
+
+	cfmt.Fprintf(console, "Checking the session that changed the password...\n")
+	if result := checkAccess(ctx, run, changing); result.Verdict == verdictAuthenticated {
+		run.Note("Session that changed the password is still authenticated")
+	} else {
+		run.Note("Session that changed the password is %s", result.Verdict)
+	}
+	for {
+		cfmt.Fprintf(console, "Checking the other session...\n")
+		result := checkAccess(ctx, run, other)
+		since := result.Time.Sub(changedAt).Round(time.Second)
+		if ctx.Err() != nil {
+			return run
+		}
+		if result.Verdict == verdictLoggedOut {
+			run.Conclude(findingPass, "other session was invalidated within %v after the password change", since)
+			return run
+		}
+		if time.Since(changedAt)+interval > invalidationWindowArg {
+			if result.Verdict == verdictAuthenticated {
+				run.Conclude(findingFail, "other session is still authenticated %v after the password change", since)
+			} else {
+				run.Conclude(findingInconclusive, "other session could not be checked: %s", result.Error)
+			}
+			return run
+		}
+		if _, ok := wait(ctx, interval); !ok {
+			return run
+		}
+	}
+}
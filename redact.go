@@ -0,0 +1,235 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/tobiashort/cfmt-go"
+	"github.com/tobiashort/clap-go"
+	. "github.com/tobiashort/utils-go/must"
+)
+
+const redacted = "REDACTED"
+
+const minSecretLength = 4
+
+const minCookieSecretLength = 16
+
+type UnredactArgs struct {
+	RunDir string `clap:"positional,mandatory,description='Directory of the test run.'"`
+	Key    string `clap:"mandatory,description='Key file that was passed to --replay-key during the run.'"`
+}
+
+var (
+	cookieHeaderPattern        = regexp.MustCompile(`(?im)\b((?:set-)?cookie:[ \t]*)([^'"\r\n]*)`)
+	authorizationHeaderPattern = regexp.MustCompile(`(?im)\b((?:proxy-)?authorization:[ \t]*)(?:(\w+)[ \t]+)?([^'"\r\n]+)`)
+	bearerTokenPattern         = regexp.MustCompile(`(?i)\b(bearer[ \t]+)[A-Za-z0-9._~+/-]+=*`)
+	jwtPattern                 = regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`)
+	sessionCookiePattern       = regexp.MustCompile(`(?i)sess|sid|token|auth|jwt|login|remember`)
+)
+
+var (
+	secretsMu      sync.RWMutex
+	secrets        = make([]string, 0)
+	redactPatterns = make([]*regexp.Regexp, 0)
+	replayKey      []byte
+)
+
+func configureRedaction(args Args) error {
+	for _, pattern := range args.Redact {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("invalid --redact pattern: %w", err)
+		}
+		redactPatterns = append(redactPatterns, re)
+	}
+	if args.ReplayKey != "" {
+		key, err := loadReplayKey(args.ReplayKey, true)
+		if err != nil {
+			return err
+		}
+		replayKey = key
+	}
+	return nil
+}
+
+func addSecret(secret string) {
+	secretsMu.Lock()
+	defer secretsMu.Unlock()
+	if len(secret) < minSecretLength || slices.Contains(secrets, secret) {
+		return
+	}
+	secrets = append(secrets, secret)
+	slices.SortFunc(secrets, func(a, b string) int { return len(b) - len(a) })
+}
+
+// addCookieSecret masks a cookie value wherever it appears only if it looks
+// like a session identifier. Cookie and Set-Cookie headers are masked by
+// pattern anyway, and values like "true" or "dark" must survive in bodies.
+func addCookieSecret(name, value string) {
+	distinct := make(map[rune]bool)
+	for _, r := range value {
+		distinct[r] = true
+	}
+	if sessionCookiePattern.MatchString(name) || (len(value) >= minCookieSecretLength && len(distinct) >= minCookieSecretLength/2) {
+		addSecret(value)
+	}
+}
+
+func addRequestSecrets(req Request) {
+	for _, pair := range strings.Split(req.Header.Get("Cookie"), ";") {
+		name, value, _ := strings.Cut(strings.TrimSpace(pair), "=")
+		addCookieSecret(name, value)
+	}
+	for _, name := range []string{"Authorization", "Proxy-Authorization"} {
+		value := req.Header.Get(name)
+		scheme, credentials, found := strings.Cut(value, " ")
+		if !found {
+			addSecret(value)
+			continue
+		}
+		credentials = strings.TrimSpace(credentials)
+		addSecret(credentials)
+		if strings.EqualFold(scheme, "Basic") {
+			if decoded, err := base64.StdEncoding.DecodeString(credentials); err == nil {
+				_, password, _ := strings.Cut(string(decoded), ":")
+				addSecret(password)
+			}
+		}
+	}
+}
+
+func redactCookies(value string, all bool) string {
+	pairs := strings.Split(value, ";")
+	for i, pair := range pairs {
+		if i > 0 && !all {
+			break
+		}
+		name, _, found := strings.Cut(pair, "=")
+		if found {
+			pairs[i] = name + "=" + redacted
+		}
+	}
+	return strings.Join(pairs, ";")
+}
+
+func redactMatches(re *regexp.Regexp, s string) string {
+	var b strings.Builder
+	last := 0
+	for _, match := range re.FindAllStringSubmatchIndex(s, -1) {
+		start, end := match[0], match[1]
+		if len(match) > 2 && match[2] >= 0 {
+			start, end = match[2], match[3]
+		}
+		b.WriteString(s[last:start])
+		b.WriteString(redacted)
+		last = end
+	}
+	b.WriteString(s[last:])
+	return b.String()
+}
+
+func redact(s string) string {
+	secretsMu.RLock()
+	for _, secret := range secrets {
+		s = strings.ReplaceAll(s, secret, redacted)
+	}
+	secretsMu.RUnlock()
+	s = cookieHeaderPattern.ReplaceAllStringFunc(s, func(match string) string {
+		groups := cookieHeaderPattern.FindStringSubmatch(match)
+		all := !strings.HasPrefix(strings.ToLower(groups[1]), "set-")
+		return groups[1] + redactCookies(groups[2], all)
+	})
+	s = authorizationHeaderPattern.ReplaceAllStringFunc(s, func(match string) string {
+		groups := authorizationHeaderPattern.FindStringSubmatch(match)
+		if groups[2] != "" {
+			return groups[1] + groups[2] + " " + redacted
+		}
+		return groups[1] + redacted
+	})
+	s = bearerTokenPattern.ReplaceAllString(s, "${1}"+redacted)
+	s = jwtPattern.ReplaceAllString(s, redacted)
+	for _, re := range redactPatterns {
+		s = redactMatches(re, s)
+	}
+	return s
+}
+
+func loadReplayKey(path string, create bool) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) && create {
+		key := make([]byte, 32)
+		Must2(rand.Read(key))
+		if err := os.WriteFile(path, []byte(hex.EncodeToString(key)+"\n"), 0600); err != nil {
+			return nil, err
+		}
+		cfmt.Printf("Created replay key #yB{'%s'}\n", path)
+		return key, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	key, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(key) != 32 {
+		return nil, fmt.Errorf("%s: expected 32 bytes in hex", path)
+	}
+	return key, nil
+}
+
+func encrypt(key []byte, plaintext []byte) []byte {
+	gcm := Must2(cipher.NewGCM(Must2(aes.NewCipher(key))))
+	nonce := make([]byte, gcm.NonceSize())
+	Must2(rand.Read(nonce))
+	return gcm.Seal(nonce, nonce, plaintext, nil)
+}
+
+func decrypt(key []byte, ciphertext []byte) ([]byte, error) {
+	gcm := Must2(cipher.NewGCM(Must2(aes.NewCipher(key))))
+	if len(ciphertext) < gcm.NonceSize() {
+		return nil, fmt.Errorf("ciphertext too short")
+	}
+	nonce, ciphertext := ciphertext[:gcm.NonceSize()], ciphertext[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ciphertext, nil)
+}
+
+func writeRequest(dir string, curlCommand string, req Request) {
+	Must(os.WriteFile(filepath.Join(dir, "curl_command"), []byte(redact(req.CurlCommand())), 0644))
+	if replayKey != nil {
+		Must(os.WriteFile(filepath.Join(dir, "curl_command.enc"), encrypt(replayKey, []byte(curlCommand)), 0600))
+	}
+}
+
+func unredactCommand() {
+	args := UnredactArgs{}
+	clap.Prog("wylmo unredact")
+	clap.Description("Print the unredacted request of a test run that was started with --replay-key.")
+	clap.Parse(&args)
+	key, err := loadReplayKey(args.Key, false)
+	if err != nil {
+		cfmt.Printf("#r{%s}\n", err.Error())
+		os.Exit(1)
+	}
+	ciphertext, err := os.ReadFile(filepath.Join(args.RunDir, "curl_command.enc"))
+	if err != nil {
+		cfmt.Printf("#r{%s}\n", err.Error())
+		os.Exit(1)
+	}
+	plaintext, err := decrypt(key, ciphertext)
+	if err != nil {
+		cfmt.Printf("#r{Cannot decrypt request: %s}\n", err.Error())
+		os.Exit(1)
+	}
+	fmt.Println(string(plaintext))
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/tobiashort/cfmt-go"
+)
+
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	Error        string `json:"error"`
+}
+
+var (
+	tokenRequest        Request
+	refreshEveryArg     time.Duration
+	keepRefreshTokenArg bool
+	tokenReference      Response
+)
+
+func configureRefresh(args Args) error {
+	refreshEveryArg = args.RefreshEvery
+	keepRefreshTokenArg = args.KeepRefreshToken
+	if args.TokenRequest == "" {
+		return nil
+	}
+	var err error
+	tokenRequest, err = readCommandFile(args.TokenRequest)
+	if err != nil {
+		return err
+	}
+	addRequestSecrets(tokenRequest)
+	token, ok := refreshTokenOf(tokenRequest)
+	if !ok {
+		return fmt.Errorf("%s: request body carries no refresh_token", args.TokenRequest)
+	}
+	addSecret(token)
+	addSecret(url.QueryEscape(token))
+	return nil
+}
+
+func isJSONBody(req Request) bool {
+	return strings.Contains(req.Header.Get("Content-Type"), "json") || strings.HasPrefix(strings.TrimSpace(req.Body), "{")
+}
+
+func refreshTokenOf(req Request) (string, bool) {
+	if isJSONBody(req) {
+		var body map[string]any
+		if json.Unmarshal([]byte(req.Body), &body) != nil {
+			return "", false
+		}
+		token, ok := body["refresh_token"].(string)
+		return token, ok && token != ""
+	}
+	values, err := url.ParseQuery(req.Body)
+	if err != nil {
+		return "", false
+	}
+	token := values.Get("refresh_token")
+	return token, token != ""
+}
+
+func withRefreshToken(req Request, token string) Request {
+	current, _ := refreshTokenOf(req)
+	req = req.Clone()
+	if isJSONBody(req) {
+		req.Body = strings.Replace(req.Body, current, token, 1)
+	} else {
+		req.Body = strings.Replace(req.Body, url.QueryEscape(current), url.QueryEscape(token), 1)
+	}
+	return req
+}
+
+func withBearer(req Request, token string) Request {
+	req = req.Clone()
+	req.Header.Set("Authorization", "Bearer "+token)
+	return req
+}
+
+func exchangeRefreshToken(ctx context.Context, run *Run, token string, waited time.Duration) (ProbeResult, TokenResponse) {
+	resp, err := sendRequest(ctx, withRefreshToken(tokenRequest, token))
+	now := time.Now()
+	result := ProbeResult{Time: now, Elapsed: now.Sub(startTime), Waited: waited, Verdict: verdictInconclusive}
+	var tokens TokenResponse
+	if err != nil {
+		result.Error = redact(err.Error())
+		run.Record(result, resp)
+		return run.state.Probes[len(run.state.Probes)-1], tokens
+	}
+	json.Unmarshal([]byte(resp.Body), &tokens)
+	addSecret(tokens.AccessToken)
+	addSecret(tokens.RefreshToken)
+	result.Status = resp.StatusCode
+	switch {
+	case resp.StatusCode < 300 && tokens.AccessToken != "":
+		result.Verdict = verdictAuthenticated
+		if tokenReference.StatusCode == 0 {
+			tokenReference = resp
+		}
+	// Only invalid_grant means the refresh token is no longer valid. Errors
+	// like invalid_client or invalid_request point at the replayed request.
+	case tokens.Error == "invalid_grant" || (resp.StatusCode == 401 && tokens.Error == ""):
+		result.Verdict = verdictLoggedOut
+	case tokens.Error != "":
+		result.Error = fmt.Sprintf("token endpoint rejected the request with %s (%s)", tokens.Error, resp.Status)
+	default:
+		result.Error = fmt.Sprintf("unexpected token response (%s)", resp.Status)
+	}
+	if tokenReference.StatusCode != 0 {
+		result.Similarity = similarityTo(tokenReference, resp)
+	}
+	run.Record(result, resp)
+	return run.state.Probes[len(run.state.Probes)-1], tokens
+}
+
+func refreshLifetime(lastSuccess *ProbeResult, longestIdle time.Duration, failure *ProbeResult) string {
+	switch {
+	case failure == nil && lastSuccess == nil:
+		return "no conclusive refresh"
+	case failure == nil:
+		return fmt.Sprintf("refresh still succeeds %v after the start and after %v of inactivity", lastSuccess.Elapsed.Round(time.Second), longestIdle)
+	case refreshEveryArg > 0 && lastSuccess == nil:
+		return fmt.Sprintf("refresh fails after %v already, the idle lifetime is shorter than --refresh-every", failure.Waited)
+	case refreshEveryArg > 0:
+		return fmt.Sprintf("absolute lifetime ends between %v and %v after the start", lastSuccess.Elapsed.Round(time.Second), failure.Elapsed.Round(time.Second))
+	case lastSuccess == nil:
+		return fmt.Sprintf("refresh fails after %v of inactivity already", failure.Waited)
+	case failure.Waited <= longestIdle:
+		return fmt.Sprintf("absolute lifetime ends between %v and %v after the start, refresh succeeded after up to %v of inactivity before", lastSuccess.Elapsed.Round(time.Second), failure.Elapsed.Round(time.Second), longestIdle)
+	default:
+		return fmt.Sprintf("idle lifetime between %v and %v, unless the absolute lifetime ended between %v and %v after the start (use --refresh-every to tell)", longestIdle, failure.Waited, lastSuccess.Elapsed.Round(time.Second), failure.Elapsed.Round(time.Second))
+	}
+}
+
+func performRefreshTokenTest(ctx context.Context, dir string, curlCommand string, req Request) *Run {
+	cfmt.Printf("Performing #yB{'%s'} test...\n", refreshTokenTest)
+	if refreshEveryArg > 0 {
+		cfmt.Printf("Refresh token is exchanged every #yB{'%v'}\n", refreshEveryArg)
+	} else {
+		cfmt.Printf("Inactivity schedule is #yB{'%v'}\n", schedule)
+		cfmt.Printf("Projected test time is #yB{%s}\n", schedule.Projection(0, 1))
+	}
+	startTime = time.Now()
+	run := startFindingSession(dir, refreshTokenTest, curlCommand, req)
+	defer run.Finish(ctx)
+
+	original, _ := refreshTokenOf(tokenRequest)
+	cfmt.Fprintf(console, "Exchanging the refresh token...\n")
+	first, tokens := exchangeRefreshToken(ctx, run, original, 0)
+	if first.Verdict != verdictAuthenticated {
+		run.Conclude(findingInconclusive, "initial refresh did not succeed (%s)", first.Verdict)
+		return run
+	}
+	cfmt.Fprintf(console, "Checking access with the new access token...\n")
+	if result := checkAccess(ctx, run, withBearer(req, tokens.AccessToken)); result.Verdict == verdictAuthenticated {
+		run.Note("Access token from the refresh grants authenticated access")
+	} else {
+		run.Note("Access token from the refresh is %s for the request", result.Verdict)
+	}
+
+	current := original
+	rotated := tokens.RefreshToken != "" && tokens.RefreshToken != original
+	reuse := ""
+	if !rotated {
+		run.Note("Refresh token is not rotated")
+	} else if keepRefreshTokenArg {
+		run.Note("Refresh token is rotated, exchanging the original token as requested by --keep-refresh-token")
+	} else {
+		run.Note("Refresh token is rotated")
+		current = tokens.RefreshToken
+		cfmt.Fprintf(console, "Exchanging the already rotated refresh token again...\n")
+		replayed, _ := exchangeRefreshToken(ctx, run, original, 0)
+		cfmt.Fprintf(console, "Exchanging the current refresh token...\n")
+		after, tokens := exchangeRefreshToken(ctx, run, current, 0)
+		if ctx.Err() != nil {
+			return run
+		}
+		switch {
+		case replayed.Verdict == verdictAuthenticated:
+			reuse = "rotated refresh token is accepted again"
+		case replayed.Verdict == verdictInconclusive:
+			reuse = "reuse of the rotated refresh token could not be checked"
+		case after.Verdict == verdictLoggedOut:
+			run.Conclude(findingPass, "rotated refresh token is rejected on reuse and the reuse revokes the current refresh token, the lifetime cannot be measured with this token")
+			return run
+		default:
+			reuse = "rotated refresh token is rejected on reuse"
+		}
+		run.Note("%s", strings.ToUpper(reuse[:1])+reuse[1:])
+		if after.Verdict == verdictAuthenticated && tokens.RefreshToken != "" {
+			current = tokens.RefreshToken
+		}
+	}
+
+	waits := schedule.Waits(0, 1)
+	if refreshEveryArg > 0 {
+		waits = func(yield func(time.Duration) bool) {
+			for yield(refreshEveryArg) {
+			}
+		}
+	}
+	var lastSuccess, failure *ProbeResult
+	longestIdle := time.Duration(0)
+	for next := range waits {
+		waited, ok := wait(ctx, next)
+		if !ok {
+			return run
+		}
+		cfmt.Fprintf(console, "Exchanging the refresh token after %v...\n", waited.Round(time.Second))
+		result, tokens := exchangeRefreshToken(ctx, run, current, waited)
+		if ctx.Err() != nil {
+			return run
+		}
+		if result.Verdict == verdictLoggedOut {
+			failure = &result
+			break
+		}
+		if result.Verdict != verdictAuthenticated {
+			continue
+		}
+		lastSuccess = &result
+		longestIdle = max(longestIdle, waited)
+		if rotated && !keepRefreshTokenArg && tokens.RefreshToken != "" {
+			current = tokens.RefreshToken
+		}
+	}
+
+	lifetime := refreshLifetime(lastSuccess, longestIdle, failure)
+	switch {
+	case strings.HasSuffix(reuse, "accepted again"):
+		run.Conclude(findingFail, "%s; %s", reuse, lifetime)
+	case reuse != "":
+		run.Conclude(findingInfo, "%s; %s", reuse, lifetime)
+	default:
+		run.Conclude(findingInfo, "%s", lifetime)
+	}
+	return run
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/tobiashort/cfmt-go"
+)
+
+var rememberMeCookieArg string
+
+func rememberMeCookie(req Request) (*http.Cookie, error) {
+	cookies, err := http.ParseCookie(req.Header.Get("Cookie"))
+	if err != nil || len(cookies) == 0 {
+		return nil, fmt.Errorf("request carries no cookies")
+	}
+	if rememberMeCookieArg != "" {
+		index := slices.IndexFunc(cookies, func(cookie *http.Cookie) bool { return cookie.Name == rememberMeCookieArg })
+		if index < 0 {
+			return nil, fmt.Errorf("request carries no cookie %s", rememberMeCookieArg)
+		}
+		return cookies[index], nil
+	}
+	if len(cookies) > 1 {
+		return nil, fmt.Errorf("request carries the cookies %s, select the remember-me cookie with --remember-me-cookie", cookieNames(cookies))
+	}
+	return cookies[0], nil
+}
+
+func withRememberMe(req Request, name string, value string) Request {
+	req = req.Clone()
+	req.Header.Set("Cookie", name+"="+value)
+	return req
+}
+
+func rotatedValue(resp Response, name string, current string) (string, bool) {
+	for _, cookie := range responseCookies(resp) {
+		if cookie.Name == name && cookie.Value != current {
+			addSecret(cookie.Value)
+			return cookie.Value, true
+		}
+	}
+	return current, false
+}
+
+func rememberMeInterval() time.Duration {
+	if intervalArg == 0 {
+		return time.Hour
+	}
+	return intervalArg
+}
+
+func performRememberMeTest(ctx context.Context, dir string, curlCommand string, req Request) *Run {
+	cfmt.Printf("Performing #yB{'%s'} test...\n", rememberMeTest)
+	interval := rememberMeInterval()
+	cfmt.Printf("Interval is set to #yB{'%v'}\n", interval)
+	startTime = time.Now()
+	run := startFindingSession(dir, rememberMeTest, curlCommand, req)
+	defer run.Finish(ctx)
+
+	cookie, err := rememberMeCookie(req)
+	if err != nil {
+		run.Conclude(findingInconclusive, "%s", err.Error())
+		return run
+	}
+	name := cookie.Name
+	current, rotated := rotatedValue(referenceResponse, name, cookie.Value)
+	previous := ""
+	if rotated {
+		previous = cookie.Value
+		run.Note("Remember-me cookie %s was rotated by the reference request", name)
+	}
+	if req.Header.Get("Authorization") != "" {
+		req = req.Clone()
+		req.Header.Del("Authorization")
+		run.Note("Authorization header is removed, only the remember-me cookie is sent")
+	}
+
+	rotations := 0
+	oldValue := ""
+	var lastAuthenticated, loggedOut *ProbeResult
+	for {
+		cfmt.Fprintf(console, "Checking access with the remember-me cookie...\n")
+		result, resp := checkAccessResponse(ctx, run, newHTTPClient(req), withRememberMe(req, name, current))
+		if ctx.Err() != nil {
+			return run
+		}
+		if result.Verdict == verdictLoggedOut {
+			loggedOut = &result
+			break
+		}
+		if result.Verdict == verdictAuthenticated {
+			lastAuthenticated = &result
+			if next, ok := rotatedValue(resp, name, current); ok {
+				rotations++
+				previous, current = current, next
+			}
+		}
+		if previous != "" && oldValue == "" {
+			cfmt.Fprintf(console, "Checking access with the previous remember-me value...\n")
+			old := checkAccess(ctx, run, withRememberMe(req, name, previous))
+			cfmt.Fprintf(console, "Checking access with the current remember-me value...\n")
+			after, resp := checkAccessResponse(ctx, run, newHTTPClient(req), withRememberMe(req, name, current))
+			if ctx.Err() != nil {
+				return run
+			}
+			oldValue = old.Verdict
+			run.Note("Previous remember-me value is %s after the rotation", old.Verdict)
+			if old.Verdict == verdictLoggedOut && after.Verdict == verdictLoggedOut {
+				run.Conclude(findingPass, "remember-me cookie is rotated on use and using the previous value revokes the current one, the lifetime cannot be measured with this cookie")
+				return run
+			}
+			if next, ok := rotatedValue(resp, name, current); ok && after.Verdict == verdictAuthenticated {
+				rotations++
+				previous, current = current, next
+			}
+		}
+		if _, ok := wait(ctx, interval); !ok {
+			return run
+		}
+	}
+
+	lifetime := fmt.Sprintf("remember-me cookie is already rejected %v after the start", loggedOut.Elapsed.Round(time.Second))
+	if lastAuthenticated != nil {
+		lifetime = fmt.Sprintf("remember-me cookie stops working between %v and %v after the start", lastAuthenticated.Elapsed.Round(time.Second), loggedOut.Elapsed.Round(time.Second))
+	}
+	switch {
+	case oldValue == verdictAuthenticated:
+		run.Conclude(findingFail, "previous remember-me values keep working after rotation; %s", lifetime)
+	case oldValue == verdictLoggedOut:
+		run.Conclude(findingInfo, "remember-me cookie is rotated on use and previous values are rejected; %s", lifetime)
+	case rotations > 0 || previous != "":
+		run.Conclude(findingInfo, "remember-me cookie is rotated on use, previous values could not be checked; %s", lifetime)
+	default:
+		run.Conclude(findingInfo, "remember-me cookie is not rotated on use; %s", lifetime)
+	}
+	return run
+}
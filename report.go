@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	. "github.com/tobiashort/utils-go/must"
+)
+
+func formatReport(state RunState, manifest []ManifestEntry) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# wylmo report\n\n")
+	fmt.Fprintf(&b, "- Test: %s\n", state.Test)
+	fmt.Fprintf(&b, "- Status: %s\n", state.Status)
+	fmt.Fprintf(&b, "- Started: %s\n", state.Started.Format(time.RFC3339))
+	if state.Stopped != nil {
+		fmt.Fprintf(&b, "- Stopped: %s\n", state.Stopped.Format(time.RFC3339))
+	}
+	fmt.Fprintf(&b, "- Probes: %d\n", len(manifest))
+	fmt.Fprintf(&b, "- Verdict: %s\n", state.Verdict)
+	if state.Stream != nil && state.Stream.Verdict != "" {
+		fmt.Fprintf(&b, "- %s\n", state.Stream.Verdict)
+	}
+	fmt.Fprintf(&b, "\n")
+	if state.Finding != nil && len(state.Finding.Details) > 0 {
+		for _, detail := range state.Finding.Details {
+			fmt.Fprintf(&b, "- %s\n", detail)
+		}
+		fmt.Fprintf(&b, "\n")
+	}
+	if len(state.Endpoints) > 0 {
+		fmt.Fprintf(&b, "| Endpoint | Verdict | Inconsistency |\n")
+		fmt.Fprintf(&b, "|---|---|---|\n")
+		for _, endpoint := range state.Endpoints {
+			fmt.Fprintf(&b, "| %s | %s | %s |\n", endpoint.Name, endpoint.Verdict, endpoint.Inconsistency)
+		}
+		fmt.Fprintf(&b, "\n")
+	}
+	fmt.Fprintf(&b, "| Probe | Time | Elapsed | Waited | Status | Similarity | Verdict | SHA-256 |\n")
+	fmt.Fprintf(&b, "|---|---|---|---|---|---|---|---|\n")
+	for _, entry := range manifest {
+		verdict := entry.Verdict
+		if entry.Error != "" {
+			verdict += " (" + entry.Error + ")"
+		}
+		fmt.Fprintf(&b, "| %s | %s | %s | %s | %d | %f | %s | %s |\n",
+			probeName(entry.Index), entry.Time, entry.Elapsed, entry.Waited, entry.Status, entry.Similarity,
+			strings.ReplaceAll(verdict, "|", "\\|"), entry.SHA256)
+	}
+	if len(state.StaleCookies) > 0 {
+		fmt.Fprintf(&b, "\n## Stale cookie replays\n\n")
+		for _, stale := range state.StaleCookies {
+			fmt.Fprintf(&b, "- %s: %s\n", stale.Time.Format(time.RFC3339), stale.Finding)
+		}
+	}
+	chains := slices.DeleteFunc(slices.Clone(manifest), func(entry ManifestEntry) bool { return len(entry.Redirects) == 0 })
+	if len(chains) > 0 {
+		fmt.Fprintf(&b, "\n## Redirect chains\n\n")
+		for _, entry := range chains {
+			fmt.Fprintf(&b, "- %s: %s\n", probeName(entry.Index), formatRedirects(entry.Redirects))
+		}
+	}
+	return b.String()
+}
+
+func writeReport(dir string, state RunState, manifest []ManifestEntry) {
+	Must(os.WriteFile(filepath.Join(dir, "report.md"), []byte(formatReport(state, manifest)), 0644))
+}
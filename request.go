@@ -0,0 +1,379 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+)
+
+type Request struct {
+	Method          string
+	URL             string
+	Header          http.Header
+	Body            string
+	FollowRedirects bool
+	Insecure        bool
+	CurlOptions     []string
+}
+
+type Response struct {
+	Status     string
+	StatusCode int
+	Header     http.Header
+	Body       string
+	Redirects  []Redirect
+}
+
+func (req Request) Clone() Request {
+	req.Header = req.Header.Clone()
+	req.CurlOptions = slices.Clone(req.CurlOptions)
+	return req
+}
+
+func (resp Response) Text() string {
+	return resp.Status + "\n" + resp.Body
+}
+
+func (req Request) CurlCommand() string {
+	var b strings.Builder
+	b.WriteString("curl")
+	if req.Method != http.MethodGet {
+		b.WriteString(" -X " + quoteShellWord(req.Method))
+	}
+	b.WriteString(" " + quoteShellWord(req.URL))
+	names := make([]string, 0, len(req.Header))
+	for name := range req.Header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, value := range req.Header[name] {
+			b.WriteString(" \\\n  -H " + quoteShellWord(name+": "+value))
+		}
+	}
+	if req.Body != "" {
+		b.WriteString(" \\\n  --data-raw " + quoteShellWord(req.Body))
+	}
+	if req.FollowRedirects {
+		b.WriteString(" -L")
+	}
+	if req.Insecure {
+		b.WriteString(" -k")
+	}
+	for _, option := range req.CurlOptions {
+		b.WriteString(" " + quoteShellWord(option))
+	}
+	return b.String()
+}
+
+func quoteShellWord(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func splitShellWords(s string) ([]string, error) {
+	words := make([]string, 0)
+	var word strings.Builder
+	inWord := false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s) && (s[i+1] == '\n' || s[i+1] == '\r'):
+			i++
+			if s[i] == '\r' && i+1 < len(s) && s[i+1] == '\n' {
+				i++
+			}
+		case c == '\\' && i+1 < len(s):
+			i++
+			word.WriteByte(s[i])
+			inWord = true
+		case c == '\'':
+			end := strings.IndexByte(s[i+1:], '\'')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated single quote")
+			}
+			word.WriteString(s[i+1 : i+1+end])
+			i += end + 1
+			inWord = true
+		case c == '$' && i+1 < len(s) && s[i+1] == '\'':
+			i += 2
+			for ; i < len(s) && s[i] != '\''; i++ {
+				if s[i] == '\\' && i+1 < len(s) {
+					i++
+					word.WriteString(unescapeANSIC(s, &i))
+				} else {
+					word.WriteByte(s[i])
+				}
+			}
+			if i >= len(s) {
+				return nil, fmt.Errorf("unterminated $'' quote")
+			}
+			inWord = true
+		case c == '"':
+			i++
+			for ; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' && i+1 < len(s) && strings.IndexByte("\\\"$`\n", s[i+1]) >= 0 {
+					i++
+					if s[i] == '\n' {
+						continue
+					}
+				}
+				word.WriteByte(s[i])
+			}
+			if i >= len(s) {
+				return nil, fmt.Errorf("unterminated double quote")
+			}
+			inWord = true
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteByte(c)
+			inWord = true
+		}
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+func unescapeANSIC(s string, i *int) string {
+	switch s[*i] {
+	case 'n':
+		return "\n"
+	case 'r':
+		return "\r"
+	case 't':
+		return "\t"
+	case '0':
+		return "\x00"
+	case 'x':
+		if *i+2 < len(s) {
+			var b byte
+			if _, err := fmt.Sscanf(s[*i+1:*i+3], "%02x", &b); err == nil {
+				*i += 2
+				return string([]byte{b})
+			}
+		}
+		return "x"
+	case 'u':
+		if *i+4 < len(s) {
+			var r rune
+			if _, err := fmt.Sscanf(s[*i+1:*i+5], "%04x", &r); err == nil {
+				*i += 4
+				return string(r)
+			}
+		}
+		return "u"
+	default:
+		return string(s[*i])
+	}
+}
+
+func parseCurlCommand(curlCommand string) (Request, error) {
+	words, err := splitShellWords(curlCommand)
+	if err != nil {
+		return Request{}, err
+	}
+	if len(words) == 0 || words[0] != "curl" {
+		return Request{}, fmt.Errorf("not a curl command")
+	}
+	req := Request{Header: make(http.Header)}
+	data := make([]string, 0)
+	get := false
+	compressed := false
+	for i := 1; i < len(words); i++ {
+		word := words[i]
+		value := func() (string, error) {
+			if i+1 >= len(words) {
+				return "", fmt.Errorf("missing value for %s", word)
+			}
+			i++
+			return words[i], nil
+		}
+		if !strings.HasPrefix(word, "-") {
+			if req.URL != "" {
+				return Request{}, fmt.Errorf("multiple URLs are not supported: %s", word)
+			}
+			req.URL = word
+			continue
+		}
+		switch word {
+		case "-X", "--request":
+			if req.Method, err = value(); err != nil {
+				return Request{}, err
+			}
+		case "-H", "--header":
+			header, err := value()
+			if err != nil {
+				return Request{}, err
+			}
+			name, val, ok := strings.Cut(header, ":")
+			if !ok {
+				return Request{}, fmt.Errorf("invalid header: %s", header)
+			}
+			req.Header.Add(strings.TrimSpace(name), strings.TrimSpace(val))
+		case "-d", "--data", "--data-raw", "--data-binary", "--data-ascii", "--data-urlencode":
+			d, err := value()
+			if err != nil {
+				return Request{}, err
+			}
+			if strings.HasPrefix(d, "@") && word != "--data-raw" {
+				return Request{}, fmt.Errorf("reading data from a file is not supported: %s", d)
+			}
+			if word == "--data-urlencode" {
+				if name, val, ok := strings.Cut(d, "="); ok {
+					d = name + "=" + url.QueryEscape(val)
+				} else {
+					d = url.QueryEscape(d)
+				}
+			}
+			data = append(data, d)
+		case "-b", "--cookie":
+			cookie, err := value()
+			if err != nil {
+				return Request{}, err
+			}
+			if !strings.Contains(cookie, "=") {
+				return Request{}, fmt.Errorf("reading cookies from a file is not supported: %s", cookie)
+			}
+			if existing := req.Header.Get("Cookie"); existing != "" {
+				cookie = existing + "; " + cookie
+			}
+			req.Header.Set("Cookie", cookie)
+		case "-u", "--user":
+			user, err := value()
+			if err != nil {
+				return Request{}, err
+			}
+			req.Header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(user)))
+		case "-A", "--user-agent":
+			userAgent, err := value()
+			if err != nil {
+				return Request{}, err
+			}
+			req.Header.Set("User-Agent", userAgent)
+		case "-e", "--referer":
+			referer, err := value()
+			if err != nil {
+				return Request{}, err
+			}
+			req.Header.Set("Referer", referer)
+		case "--url":
+			if req.URL, err = value(); err != nil {
+				return Request{}, err
+			}
+		case "-I", "--head":
+			req.Method = http.MethodHead
+		case "-G", "--get":
+			get = true
+		case "-L", "--location":
+			req.FollowRedirects = true
+		case "-k", "--insecure":
+			req.Insecure = true
+		case "--compressed":
+			compressed = true
+		case "-s", "--silent", "-S", "--show-error", "-v", "--verbose", "-g", "--globoff":
+		default:
+			// Options wylmo does not handle itself are passed through to curl,
+			// which then sends the request.
+			req.CurlOptions = append(req.CurlOptions, word)
+			if curlValueOptions[word] {
+				option, err := value()
+				if err != nil {
+					return Request{}, err
+				}
+				req.CurlOptions = append(req.CurlOptions, option)
+			}
+		}
+	}
+	if compressed {
+		req.Header.Del("Accept-Encoding")
+	}
+	if req.URL == "" {
+		return Request{}, fmt.Errorf("missing URL")
+	}
+	if len(data) > 0 {
+		if get {
+			sep := "?"
+			if strings.Contains(req.URL, "?") {
+				sep = "&"
+			}
+			req.URL += sep + strings.Join(data, "&")
+		} else {
+			req.Body = strings.Join(data, "&")
+			if req.Method == "" {
+				req.Method = http.MethodPost
+			}
+			if req.Header.Get("Content-Type") == "" {
+				req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			}
+		}
+	}
+	if req.Method == "" {
+		req.Method = http.MethodGet
+	}
+	if _, err := url.ParseRequestURI(req.URL); err != nil {
+		return Request{}, err
+	}
+	return req, nil
+}
+
+func sendRequest(ctx context.Context, req Request) (Response, error) {
+	return sendRequestWith(ctx, newHTTPClient(req), req)
+}
+
+func sendRequestWith(ctx context.Context, client *http.Client, req Request) (Response, error) {
+	if len(req.CurlOptions) > 0 {
+		return sendCurl(ctx, req)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, req.Method, req.URL, strings.NewReader(req.Body))
+	if err != nil {
+		return Response{}, err
+	}
+	httpReq.Header = req.Header.Clone()
+	if host := req.Header.Get("Host"); host != "" {
+		httpReq.Host = host
+	}
+	if client.Jar != nil {
+		httpReq.Header.Del("Cookie")
+	}
+	redirects := make([]Redirect, 0)
+	recording := *client
+	recording.CheckRedirect = func(next *http.Request, via []*http.Request) error {
+		if client.CheckRedirect != nil {
+			if err := client.CheckRedirect(next, via); err != nil {
+				return err
+			}
+		} else if len(via) >= 10 {
+			return fmt.Errorf("stopped after 10 redirects")
+		}
+		redirects = append(redirects, Redirect{Status: next.Response.StatusCode, From: via[len(via)-1].URL.String(), To: next.URL.String()})
+		return nil
+	}
+	httpResp, err := recording.Do(httpReq)
+	if err != nil {
+		return Response{}, err
+	}
+	defer httpResp.Body.Close()
+	body, err := io.ReadAll(httpResp.Body)
+	if err != nil {
+		return Response{}, err
+	}
+	return Response{
+		Status:     httpResp.Proto + " " + httpResp.Status,
+		StatusCode: httpResp.StatusCode,
+		Header:     httpResp.Header,
+		Body:       string(body),
+		Redirects:  redirects,
+	}, nil
+}
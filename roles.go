@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tobiashort/cfmt-go"
+	. "github.com/tobiashort/utils-go/must"
+)
+
+type RoleConfig struct {
+	Name       string `json:"name"`
+	Request    string `json:"request,omitempty"`
+	Login      string `json:"login,omitempty"`
+	MaxTimeout string `json:"max_timeout,omitempty"`
+}
+
+type RoleDefinition struct {
+	Test    string       `json:"test,omitempty"`
+	Request string       `json:"request,omitempty"`
+	Roles   []RoleConfig `json:"roles"`
+}
+
+type RoleResult struct {
+	Role        string `json:"role"`
+	Status      string `json:"status"`
+	Probes      int    `json:"probes"`
+	LowerBound  string `json:"lower_bound,omitempty"`
+	UpperBound  string `json:"upper_bound,omitempty"`
+	MaxTimeout  string `json:"max_timeout,omitempty"`
+	Result      string `json:"result,omitempty"`
+	Verdict     string `json:"verdict"`
+	curlCommand string
+	req         Request
+	reference   Response
+	maxTimeout  time.Duration
+}
+
+type RoleComparison struct {
+	Test    string       `json:"test"`
+	Started string       `json:"started"`
+	Roles   []RoleResult `json:"roles"`
+}
+
+func loadRoleDefinition(path string) (RoleDefinition, error) {
+	definition := RoleDefinition{}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return definition, err
+	}
+	if err := json.Unmarshal(data, &definition); err != nil {
+		return definition, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(definition.Roles) == 0 {
+		return definition, fmt.Errorf("%s: no roles", path)
+	}
+	if definition.Test != "" && definition.Test != hardTimeoutTest && definition.Test != inactivityTimeoutTest {
+		return definition, fmt.Errorf("%s: role comparison supports the '%s' and '%s' tests", path, hardTimeoutTest, inactivityTimeoutTest)
+	}
+	base := filepath.Dir(path)
+	resolve := func(file string) string {
+		if file == "" || filepath.IsAbs(file) {
+			return file
+		}
+		return filepath.Join(base, file)
+	}
+	definition.Request = resolve(definition.Request)
+	names := make(map[string]bool)
+	for i := range definition.Roles {
+		role := &definition.Roles[i]
+		if role.Name == "" || names[role.Name] || strings.ContainsAny(role.Name, `/\`) {
+			return definition, fmt.Errorf("%s: role %d needs a unique name without slashes", path, i+1)
+		}
+		names[role.Name] = true
+		if role.Request == "" && definition.Request == "" {
+			return definition, fmt.Errorf("%s: role %s has no request and there is no default request", path, role.Name)
+		}
+		role.Request = resolve(role.Request)
+		role.Login = resolve(role.Login)
+	}
+	return definition, nil
+}
+
+func prepareRole(ctx context.Context, definition RoleDefinition, role RoleConfig) (RoleResult, error) {
+	result := RoleResult{Role: role.Name, MaxTimeout: role.MaxTimeout}
+	if role.MaxTimeout != "" {
+		maxTimeout, err := time.ParseDuration(role.MaxTimeout)
+		if err != nil {
+			return result, fmt.Errorf("role %s: invalid max_timeout: %w", role.Name, err)
+		}
+		result.maxTimeout = maxTimeout
+	}
+	file := role.Request
+	if file == "" {
+		file = definition.Request
+	}
+	req, err := readCommandFile(file)
+	if err != nil {
+		return result, fmt.Errorf("role %s: %w", role.Name, err)
+	}
+	addRequestSecrets(req)
+	if role.Login != "" {
+		login, err := readCommandFile(role.Login)
+		if err != nil {
+			return result, fmt.Errorf("role %s: %w", role.Name, err)
+		}
+		addRequestSecrets(login)
+		req, err = loginSession(ctx, login, req)
+		if err != nil {
+			return result, fmt.Errorf("role %s: %w", role.Name, err)
+		}
+	}
+	resp, err := sendRequest(ctx, req)
+	if err != nil {
+		return result, fmt.Errorf("role %s: reference request failed: %s", role.Name, redact(err.Error()))
+	}
+	if resp.StatusCode >= 400 {
+		return result, fmt.Errorf("role %s: reference request returned %s", role.Name, resp.Status)
+	}
+	cfmt.Printf("Reference response of #yB{'%s'} is #yB{%s} with %d bytes\n", role.Name, resp.Status, len(resp.Body))
+	result.curlCommand = req.CurlCommand()
+	result.req = req
+	result.reference = resp
+	return result, nil
+}
+
+func compareRole(typeOfTest string, result *RoleResult, run *Run) {
+	result.Status = run.state.Status
+	result.Probes = len(run.state.Probes)
+	result.Verdict = run.state.Verdict
+	lastAuthenticated, loggedOut := logoutWindow(run.state.Probes)
+	if lastAuthenticated != nil {
+		result.LowerBound = measure(typeOfTest, *lastAuthenticated).String()
+	}
+	if loggedOut != nil {
+		result.UpperBound = measure(typeOfTest, *loggedOut).String()
+	}
+	switch {
+	case result.maxTimeout == 0:
+	case loggedOut != nil && measure(typeOfTest, *loggedOut) <= result.maxTimeout:
+		result.Result = findingPass
+	case lastAuthenticated != nil && measure(typeOfTest, *lastAuthenticated) > result.maxTimeout:
+		result.Result = findingFail
+	default:
+		result.Result = findingInconclusive
+	}
+}
+
+func formatRoleReport(comparison RoleComparison) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# wylmo role comparison\n\n")
+	fmt.Fprintf(&b, "- Test: %s\n", comparison.Test)
+	fmt.Fprintf(&b, "- Started: %s\n\n", comparison.Started)
+	fmt.Fprintf(&b, "| Role | Status | Probes | Authenticated until | Logged out at | Expected at most | Result | Verdict |\n")
+	fmt.Fprintf(&b, "|---|---|---|---|---|---|---|---|\n")
+	for _, role := range comparison.Roles {
+		fmt.Fprintf(&b, "| %s | %s | %d | %s | %s | %s | %s | %s |\n",
+			role.Role, role.Status, role.Probes, role.LowerBound, role.UpperBound, role.MaxTimeout, strings.ToUpper(role.Result), role.Verdict)
+	}
+	return b.String()
+}
+
+func performRoleComparison(ctx context.Context, typeOfTest string, definition RoleDefinition) {
+	cfmt.Printf("Performing #yB{'%s'} test for #yB{%d} roles...\n", typeOfTest, len(definition.Roles))
+	results := make([]RoleResult, 0, len(definition.Roles))
+	for _, role := range definition.Roles {
+		result, err := prepareRole(ctx, definition, role)
+		if err != nil {
+			cfmt.Printf("#r{%s}\n", err.Error())
+			return
+		}
+		results = append(results, result)
+	}
+	dir, err := createRunDir(typeOfTest, results[0].req)
+	if err != nil {
+		cfmt.Printf("#r{Cannot create run directory: %s}\n", err.Error())
+		return
+	}
+	cfmt.Printf("Results are written to #yB{'%s'}\n", dir)
+	interval := hardTimeoutInterval()
+	if typeOfTest == hardTimeoutTest {
+		cfmt.Printf("Interval is set to #yB{'%v'}\n", interval)
+	} else {
+		cfmt.Printf("Schedule is #yB{'%v'}\n", schedule)
+		cfmt.Printf("Projected test time is #yB{%s}\n", schedule.Projection(0, 1))
+	}
+	startTime = time.Now()
+	runs := make([]*Run, len(results))
+	var wg sync.WaitGroup
+	for i := range results {
+		roleDir := filepath.Join(dir, results[i].Role)
+		Must(os.Mkdir(roleDir, 0755))
+		run, jar := startSession(roleDir, typeOfTest, results[i].curlCommand, results[i].req, results[i].reference)
+		run.label = results[i].Role
+		run.stopOnLogout = true
+		runs[i] = run
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer jar.Close()
+			defer run.Finish(ctx)
+			if typeOfTest == hardTimeoutTest {
+				hardTimeoutLoop(ctx, run, results[i].req, jar, interval)
+			} else {
+				waits := func(yield func(time.Duration) bool) {
+					if yield(0) {
+						schedule.Waits(0, 1)(yield)
+					}
+				}
+				inactivityTimeoutLoop(ctx, run, results[i].req, jar, waits)
+			}
+		}()
+	}
+	wg.Wait()
+	comparison := RoleComparison{Test: typeOfTest, Started: startTime.Format(time.RFC3339)}
+	for i := range results {
+		compareRole(typeOfTest, &results[i], runs[i])
+		comparison.Roles = append(comparison.Roles, results[i])
+	}
+	writeJSON(filepath.Join(dir, "roles.json"), comparison)
+	Must(os.WriteFile(filepath.Join(dir, "report.md"), []byte(formatRoleReport(comparison)), 0644))
+	for _, role := range comparison.Roles {
+		verdict := role.Verdict
+		if role.Result != "" {
+			verdict += fmt.Sprintf(" (at most %s expected: %s)", role.MaxTimeout, strings.ToUpper(role.Result))
+		}
+		cfmt.Printf("[%s] Verdict: #yB{%s}\n", role.Role, verdict)
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/tobiashort/cfmt-go"
+	. "github.com/tobiashort/utils-go/must"
+)
+
+const (
+	runStatusRunning = "running"
+	runStatusStopped = "stopped"
+	runStatusAborted = "aborted"
+)
+
+type RunState struct {
+	Test         string              `json:"test"`
+	Status       string              `json:"status"`
+	Started      time.Time           `json:"started"`
+	Stopped      *time.Time          `json:"stopped,omitempty"`
+	Verdict      string              `json:"verdict"`
+	Finding      *Finding            `json:"finding,omitempty"`
+	Stream       *StreamResult       `json:"stream,omitempty"`
+	Endpoints    []EndpointResult    `json:"endpoints,omitempty"`
+	StaleCookies []StaleCookieResult `json:"stale_cookies,omitempty"`
+	Probes       []ProbeResult       `json:"probes"`
+}
+
+type Run struct {
+	label        string
+	dir          string
+	logFile      *os.File
+	state        RunState
+	manifest     []ManifestEntry
+	chain        string
+	loggedOut    bool
+	inconclusive int
+	failing      bool
+	stopOnLogout bool
+	proceed      func(next time.Duration) bool
+	stream       *StreamMonitor
+	reference    Response
+	endpoints    []*Endpoint
+}
+
+func newRun(dir string, typeOfTest string) *Run {
+	run := &Run{
+		dir:          dir,
+		stopOnLogout: trialsArg > 1,
+		logFile:      Must2(os.OpenFile(filepath.Join(dir, "log"), os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0644)),
+		manifest:     make([]ManifestEntry, 0),
+		chain:        sha256Hex(Must2(os.ReadFile(filepath.Join(dir, "reference.body")))),
+		state: RunState{
+			Test:    typeOfTest,
+			Status:  runStatusRunning,
+			Started: startTime,
+			Probes:  make([]ProbeResult, 0),
+		},
+	}
+	run.save()
+	return run
+}
+
+func (run *Run) Record(result ProbeResult, resp Response) {
+	result.Index = len(run.state.Probes) + 1
+	entry := writeProbeEvidence(run.dir, result, resp, run.chain)
+	run.chain = entry.Chain
+	result.SHA256 = entry.SHA256
+	name := probeName(result.Index)
+	if result.Error != "" {
+		cfmt.Fprintf(console, "%s%v %s #r{%s}\n", run.prefix(), formatTime(result.Time), name, result.Error)
+		Must2(fmt.Fprintf(run.logFile, "%v %s %s\n", formatTime(result.Time), name, result.Error))
+	} else {
+		cfmt.Fprintf(console, "%s%v %s #yB{%f} similarity %s\n", run.prefix(), formatTime(result.Time), name, result.Similarity, colorByVerdict(result.Verdict, result.Verdict))
+		Must2(fmt.Fprintf(run.logFile, "%v %s %f similarity %s\n", formatTime(result.Time), name, result.Similarity, result.Verdict))
+	}
+	run.state.Probes = append(run.state.Probes, result)
+	run.manifest = append(run.manifest, entry)
+	run.state.Verdict = run.summary()
+	run.save()
+	if dashboard != nil && run.label == "" {
+		dashboard.Record(result)
+	}
+	if run.state.Finding == nil {
+		run.notifyProbe(result)
+	}
+}
+
+func (run *Run) notifyProbe(result ProbeResult) {
+	when := formatTime(result.Time)
+	switch result.Verdict {
+	case verdictLoggedOut:
+		if !run.loggedOut {
+			notify(eventLogoutDetected, run.state.Test, run.dir, "Logout detected at "+when, run.state.Verdict)
+		}
+		run.loggedOut = true
+		run.inconclusive = 0
+	case verdictAuthenticated:
+		run.loggedOut = false
+		run.inconclusive = 0
+	default:
+		run.inconclusive++
+		if run.inconclusive == inconclusiveStreakArg {
+			message := fmt.Sprintf("%d inconclusive probes in a row at %s", run.inconclusive, when)
+			notify(eventInconclusiveStreak, run.state.Test, run.dir, message, run.state.Verdict)
+		}
+	}
+	if result.Error != "" && !run.failing {
+		notify(eventError, run.state.Test, run.dir, "Probe failed at "+when+": "+result.Error, run.state.Verdict)
+	}
+	run.failing = result.Error != ""
+}
+
+func (run *Run) summary() string {
+	if finding := run.state.Finding; finding != nil {
+		return fmt.Sprintf("%s: %s, %s", run.state.Test, strings.ToUpper(finding.Result), finding.Summary)
+	}
+	if ssoEnabled() && slices.ContainsFunc(run.state.Probes, func(result ProbeResult) bool { return viaIdP(result.Redirects) }) {
+		return summarizeSSO(run.state.Test, run.state.Probes)
+	}
+	return summarize(run.state.Test, run.state.Probes)
+}
+
+func (run *Run) Done() bool {
+	return run.stopOnLogout && run.loggedOut
+}
+
+func (run *Run) Proceed(next time.Duration) bool {
+	return run.proceed == nil || run.proceed(next)
+}
+
+func (run *Run) prefix() string {
+	if run.label == "" {
+		return ""
+	}
+	return "[" + run.label + "] "
+}
+
+func (run *Run) Finish(ctx context.Context) {
+	now := time.Now()
+	run.state.Stopped = &now
+	run.state.Status = runStatusStopped
+	if ctx.Err() != nil {
+		run.state.Status = runStatusAborted
+	}
+	if run.stream != nil {
+		stream := run.stream.Stop()
+		run.state.Stream = &stream
+	}
+	run.state.Verdict = run.summary()
+	run.finishEndpoints(ctx)
+	run.save()
+	writeReport(run.dir, run.state, run.manifest)
+	message := fmt.Sprintf("Test %s after %v with %d probes", run.state.Status, now.Sub(startTime).Round(time.Second), len(run.state.Probes))
+	cfmt.Fprintf(console, "%s%s\n", run.prefix(), message)
+	cfmt.Fprintf(console, "%sVerdict: #yB{%s}\n", run.prefix(), run.state.Verdict)
+	if run.state.Stream != nil && run.state.Stream.Verdict != "" {
+		cfmt.Fprintf(console, "%sVerdict: #yB{%s}\n", run.prefix(), run.state.Stream.Verdict)
+	}
+	for _, endpoint := range run.state.Endpoints {
+		if endpoint.Inconsistency != "" {
+			cfmt.Fprintf(console, "%s#r{Endpoint '%s' is %s}\n", run.prefix(), endpoint.Name, endpoint.Inconsistency)
+		}
+	}
+	notify(eventRunFinished, run.state.Test, run.dir, message, run.state.Verdict)
+	run.logFile.Close()
+}
+
+func (run *Run) save() {
+	writeJSON(filepath.Join(run.dir, "state.json"), run.state)
+	writeJSON(filepath.Join(run.dir, "manifest.json"), run.manifest)
+}
+
+func writeJSON(path string, v any) {
+	data := Must2(json.MarshalIndent(v, "", "  "))
+	tmp := path + ".tmp"
+	Must(os.WriteFile(tmp, data, 0644))
+	Must(os.Rename(tmp, path))
+}
+
+func measure(typeOfTest string, result ProbeResult) time.Duration {
+	if typeOfTest == inactivityTimeoutTest {
+		return result.Waited
+	}
+	return result.Elapsed
+}
+
+func logoutWindow(results []ProbeResult) (*ProbeResult, *ProbeResult) {
+	var lastAuthenticated *ProbeResult
+	for i, result := range results {
+		switch result.Verdict {
+		case verdictAuthenticated:
+			lastAuthenticated = &results[i]
+		case verdictLoggedOut:
+			return lastAuthenticated, &results[i]
+		}
+	}
+	return lastAuthenticated, nil
+}
+
+func summarize(typeOfTest string, results []ProbeResult) string {
+	lastAuthenticated, loggedOut := logoutWindow(results)
+	switch {
+	case loggedOut != nil && lastAuthenticated == nil:
+		return fmt.Sprintf("%s: already logged out at the first conclusive probe (%v)", typeOfTest, measure(typeOfTest, *loggedOut))
+	case loggedOut != nil:
+		return fmt.Sprintf("%s: logged out between %v and %v", typeOfTest, measure(typeOfTest, *lastAuthenticated), measure(typeOfTest, *loggedOut))
+	case lastAuthenticated != nil:
+		return fmt.Sprintf("%s: no logout observed, still authenticated after %v", typeOfTest, measure(typeOfTest, *lastAuthenticated))
+	default:
+		return fmt.Sprintf("%s: no conclusive probe", typeOfTest)
+	}
+}
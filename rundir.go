@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+func pathSegment(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '.', r == '-':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r - 'A' + 'a'
+		default:
+			return '-'
+		}
+	}, s)
+}
+
+func targetHost(req Request) string {
+	u, err := url.Parse(req.URL)
+	if err != nil || u.Host == "" {
+		return "unknown-host"
+	}
+	return pathSegment(u.Host)
+}
+
+func createRunDir(typeOfTest string, req Request) (string, error) {
+	if outputArg != "" {
+		entries, err := os.ReadDir(outputArg)
+		if err == nil && len(entries) > 0 {
+			return "", fmt.Errorf("output directory is not empty: %s", outputArg)
+		}
+		return outputArg, os.MkdirAll(outputArg, 0755)
+	}
+	parent := filepath.Join("runs", targetHost(req))
+	if err := os.MkdirAll(parent, 0755); err != nil {
+		return "", err
+	}
+	name := pathSegment(typeOfTest) + "-" + time.Now().Format("20060102-150405")
+	dir := filepath.Join(parent, name)
+	for i := 2; ; i++ {
+		err := os.Mkdir(dir, 0755)
+		if err == nil {
+			break
+		}
+		if !os.IsExist(err) {
+			return "", err
+		}
+		dir = filepath.Join(parent, fmt.Sprintf("%s-%d", name, i))
+	}
+	latest := filepath.Join(parent, "latest")
+	tmp := latest + ".tmp"
+	os.Remove(tmp)
+	if err := os.Symlink(filepath.Base(dir), tmp); err != nil {
+		return "", err
+	}
+	return dir, os.Rename(tmp, latest)
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"iter"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	linearSchedule    = "linear"
+	geometricSchedule = "geometric"
+	listSchedule      = "list"
+)
+
+type ScheduleConfig struct {
+	Type     string   `json:"type"`
+	Step     string   `json:"step,omitempty"`
+	Start    string   `json:"start,omitempty"`
+	Factor   float64  `json:"factor,omitempty"`
+	Waits    []string `json:"waits,omitempty"`
+	MaxTotal string   `json:"max_total,omitempty"`
+}
+
+type Schedule struct {
+	kind     string
+	step     time.Duration
+	factor   float64
+	waits    []time.Duration
+	maxTotal time.Duration
+}
+
+var schedule Schedule
+
+func parseDurations(values []string) ([]time.Duration, error) {
+	durations := make([]time.Duration, 0, len(values))
+	for _, value := range values {
+		d, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil {
+			return nil, err
+		}
+		if d <= 0 {
+			return nil, fmt.Errorf("duration must be positive: %s", value)
+		}
+		durations = append(durations, d)
+	}
+	return durations, nil
+}
+
+func parseScheduleSpec(spec string) (ScheduleConfig, error) {
+	kind, params, _ := strings.Cut(spec, ":")
+	config := ScheduleConfig{Type: kind}
+	values := strings.Split(params, ",")
+	switch kind {
+	case linearSchedule:
+		config.Step = params
+	case geometricSchedule:
+		config.Start = values[0]
+		if len(values) > 1 {
+			factor, err := strconv.ParseFloat(strings.TrimSpace(values[1]), 64)
+			if err != nil {
+				return config, fmt.Errorf("invalid factor: %s", values[1])
+			}
+			config.Factor = factor
+		}
+	case listSchedule:
+		config.Waits = values
+	default:
+		return config, fmt.Errorf("unknown schedule type %q (expected linear, geometric or list)", kind)
+	}
+	return config, nil
+}
+
+func newSchedule(config ScheduleConfig) (Schedule, error) {
+	s := Schedule{kind: config.Type, factor: 2}
+	var err error
+	switch config.Type {
+	case linearSchedule:
+		s.step = inactivityTimeoutStep()
+		if config.Step != "" {
+			s.step, err = time.ParseDuration(config.Step)
+		}
+	case geometricSchedule:
+		s.step, err = time.ParseDuration(config.Start)
+		if config.Factor != 0 {
+			s.factor = config.Factor
+		}
+		if s.factor <= 1 {
+			return s, fmt.Errorf("geometric factor must be greater than 1")
+		}
+	case listSchedule:
+		s.waits, err = parseDurations(config.Waits)
+		if err == nil && len(s.waits) == 0 {
+			err = fmt.Errorf("list schedule needs at least one duration")
+		}
+	default:
+		return s, fmt.Errorf("unknown schedule type %q (expected linear, geometric or list)", config.Type)
+	}
+	if err != nil {
+		return s, fmt.Errorf("invalid %s schedule: %w", config.Type, err)
+	}
+	if s.kind != listSchedule && s.step <= 0 {
+		return s, fmt.Errorf("invalid %s schedule: duration must be positive", config.Type)
+	}
+	if config.MaxTotal != "" {
+		s.maxTotal, err = time.ParseDuration(config.MaxTotal)
+		if err != nil {
+			return s, fmt.Errorf("invalid max total: %w", err)
+		}
+	}
+	return s, nil
+}
+
+func configureSchedule(args Args) error {
+	config := ScheduleConfig{Type: linearSchedule}
+	if args.ScheduleFile != "" {
+		data, err := os.ReadFile(args.ScheduleFile)
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(data, &config); err != nil {
+			return fmt.Errorf("%s: %w", args.ScheduleFile, err)
+		}
+	}
+	if args.Schedule != "" {
+		maxTotal := config.MaxTotal
+		var err error
+		config, err = parseScheduleSpec(args.Schedule)
+		if err != nil {
+			return err
+		}
+		config.MaxTotal = maxTotal
+	}
+	if args.MaxTotal != 0 {
+		config.MaxTotal = args.MaxTotal.String()
+	}
+	var err error
+	schedule, err = newSchedule(config)
+	return err
+}
+
+func (s Schedule) wait(i int) (time.Duration, bool) {
+	switch s.kind {
+	case linearSchedule:
+		return time.Duration(i+1) * s.step, true
+	case geometricSchedule:
+		wait := float64(s.step) * math.Pow(s.factor, float64(i))
+		if wait > math.MaxInt64 {
+			return 0, false
+		}
+		return time.Duration(wait), true
+	default:
+		if i >= len(s.waits) {
+			return 0, false
+		}
+		return s.waits[i], true
+	}
+}
+
+// Waits yields the waits at schedule positions first, first+stride, ... and
+// stops before the accumulated waiting exceeds the maximum total.
+func (s Schedule) Waits(first int, stride int) iter.Seq[time.Duration] {
+	return func(yield func(time.Duration) bool) {
+		total := time.Duration(0)
+		for i := first; ; i += stride {
+			wait, ok := s.wait(i)
+			if !ok {
+				return
+			}
+			total += wait
+			if s.maxTotal > 0 && total > s.maxTotal {
+				return
+			}
+			if !yield(wait) {
+				return
+			}
+		}
+	}
+}
+
+func (s Schedule) String() string {
+	var description string
+	switch s.kind {
+	case linearSchedule:
+		description = fmt.Sprintf("linear, step %v", s.step)
+	case geometricSchedule:
+		description = fmt.Sprintf("geometric, start %v, factor %g", s.step, s.factor)
+	default:
+		description = fmt.Sprintf("list of %d waits", len(s.waits))
+	}
+	if s.maxTotal > 0 {
+		description += fmt.Sprintf(", at most %v in total", s.maxTotal)
+	}
+	return description
+}
+
+func (s Schedule) Projection(first int, stride int) string {
+	waits := make([]string, 0)
+	total := time.Duration(0)
+	bounded := s.kind == listSchedule || s.maxTotal > 0
+	for wait := range s.Waits(first, stride) {
+		if !bounded && len(waits) == 5 {
+			return fmt.Sprintf("unbounded, runs until logout (waits %s, ...)", strings.Join(waits, ", "))
+		}
+		waits = append(waits, wait.String())
+		total += wait
+	}
+	if len(waits) > 8 {
+		waits = append(waits[:4], append([]string{"..."}, waits[len(waits)-3:]...)...)
+	}
+	return fmt.Sprintf("%v at most (waits %s)", total, strings.Join(waits, ", "))
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"path"
+	"strings"
+)
+
+type Redirect struct {
+	Status int    `json:"status"`
+	From   string `json:"from"`
+	To     string `json:"to"`
+	IdP    bool   `json:"idp,omitempty"`
+}
+
+var (
+	idpHostPatterns = make([]string, 0)
+	idpCookies      = make(map[string][]*http.Cookie)
+)
+
+func configureSSO(args Args) error {
+	for _, pattern := range args.IdpHost {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid --idp-host pattern %q: %w", pattern, err)
+		}
+		idpHostPatterns = append(idpHostPatterns, pattern)
+	}
+	for _, value := range args.IdpCookie {
+		host, header, ok := strings.Cut(value, "=")
+		if !ok {
+			return fmt.Errorf("--idp-cookie expects host=cookies, got %q", value)
+		}
+		cookies, err := http.ParseCookie(header)
+		if err != nil {
+			return fmt.Errorf("invalid --idp-cookie for %s: %w", host, err)
+		}
+		for _, cookie := range cookies {
+			cookie.Path = "/"
+			addSecret(cookie.Value)
+		}
+		idpCookies[host] = append(idpCookies[host], cookies...)
+	}
+	return nil
+}
+
+func ssoEnabled() bool {
+	return len(idpHostPatterns) > 0
+}
+
+func isIdPHost(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	for _, pattern := range idpHostPatterns {
+		if matched, _ := path.Match(pattern, u.Hostname()); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// newProbeClient follows redirects with a cookie jar when IdP hosts are
+// configured, so that a silent re-authentication through the IdP completes
+// like in the browser. The jar only lives for a single probe.
+func newProbeClient(req Request) *http.Client {
+	client := newHTTPClient(req)
+	if !ssoEnabled() {
+		return client
+	}
+	jar, _ := cookiejar.New(nil)
+	if u, err := url.Parse(req.URL); err == nil {
+		cookies, _ := http.ParseCookie(req.Header.Get("Cookie"))
+		for _, cookie := range cookies {
+			cookie.Path = "/"
+		}
+		jar.SetCookies(u, cookies)
+	}
+	for host, cookies := range idpCookies {
+		jar.SetCookies(&url.URL{Scheme: "https", Host: host, Path: "/"}, cookies)
+	}
+	client.Jar = jar
+	client.CheckRedirect = nil
+	return client
+}
+
+func redactRedirects(redirects []Redirect) []Redirect {
+	if len(redirects) == 0 {
+		return nil
+	}
+	redacted := make([]Redirect, 0, len(redirects))
+	for _, redirect := range redirects {
+		redirect.IdP = isIdPHost(redirect.From) || isIdPHost(redirect.To)
+		redirect.From = redact(redirect.From)
+		redirect.To = redact(redirect.To)
+		redacted = append(redacted, redirect)
+	}
+	return redacted
+}
+
+func viaIdP(redirects []Redirect) bool {
+	for _, redirect := range redirects {
+		if redirect.IdP {
+			return true
+		}
+	}
+	return false
+}
+
+func formatRedirects(redirects []Redirect) string {
+	hops := make([]string, 0, len(redirects))
+	for _, redirect := range redirects {
+		hop := fmt.Sprintf("%d %s -> %s", redirect.Status, redirect.From, redirect.To)
+		if redirect.IdP {
+			hop += " (IdP)"
+		}
+		hops = append(hops, hop)
+	}
+	return strings.Join(hops, ", ")
+}
+
+func summarizeSSO(typeOfTest string, results []ProbeResult) string {
+	var appLast, appFirst, idpLast, idpFirst *ProbeResult
+	for i, result := range results {
+		idp := viaIdP(result.Redirects)
+		switch result.Verdict {
+		case verdictAuthenticated:
+			if appFirst == nil && !idp {
+				appLast = &results[i]
+			}
+			if appFirst == nil && idp {
+				appFirst = &results[i]
+			}
+			if idpFirst == nil && idp {
+				idpLast = &results[i]
+			}
+		case verdictLoggedOut:
+			if appFirst == nil {
+				appFirst = &results[i]
+			}
+			if idpFirst == nil && idp {
+				idpFirst = &results[i]
+			}
+		}
+	}
+	var app string
+	switch {
+	case appFirst == nil && appLast == nil:
+		app = "no conclusive probe"
+	case appFirst == nil:
+		app = fmt.Sprintf("application session still active after %v", measure(typeOfTest, *appLast))
+	case appLast == nil:
+		app = fmt.Sprintf("application session already expired at the first conclusive probe (%v)", measure(typeOfTest, *appFirst))
+	default:
+		app = fmt.Sprintf("application session expired between %v and %v", measure(typeOfTest, *appLast), measure(typeOfTest, *appFirst))
+	}
+	if appFirst != nil && appFirst.Verdict == verdictAuthenticated {
+		app += " (silent re-authentication via the IdP)"
+	}
+	var idp string
+	switch {
+	case idpFirst != nil && idpLast == nil:
+		idp = fmt.Sprintf("IdP session expired by %v, the lower bound is unknown because no earlier authenticated probe reached the IdP", measure(typeOfTest, *idpFirst))
+	case idpFirst != nil:
+		idp = fmt.Sprintf("IdP session expired between %v and %v", measure(typeOfTest, *idpLast), measure(typeOfTest, *idpFirst))
+	case idpLast != nil:
+		idp = fmt.Sprintf("IdP session still active after %v", measure(typeOfTest, *idpLast))
+	default:
+		idp = "IdP session not reached"
+	}
+	return fmt.Sprintf("%s: %s; %s", typeOfTest, app, idp)
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tobiashort/cfmt-go"
+	. "github.com/tobiashort/utils-go/must"
+)
+
+const (
+	streamSSE      = "sse"
+	streamLongPoll = "long-poll"
+)
+
+const streamRetryDelay = 5 * time.Second
+
+const maxStreamEventLog = 200
+
+type StreamConnection struct {
+	Opened      time.Time     `json:"opened"`
+	Lifetime    time.Duration `json:"lifetime"`
+	Status      int           `json:"status,omitempty"`
+	Events      int           `json:"events"`
+	Heartbeats  int           `json:"heartbeats"`
+	Termination string        `json:"termination"`
+}
+
+type StreamResult struct {
+	URL         string             `json:"url"`
+	Mode        string             `json:"mode,omitempty"`
+	ContentType string             `json:"content_type,omitempty"`
+	Verdict     string             `json:"verdict"`
+	Connections []StreamConnection `json:"connections"`
+}
+
+type StreamMonitor struct {
+	dir     string
+	logFile *os.File
+	mu      sync.Mutex
+	result  StreamResult
+	cancel  context.CancelFunc
+	done    chan struct{}
+}
+
+var streamURLArg string
+
+func streamRequest(req Request) Request {
+	req = req.Clone()
+	req.Method = http.MethodGet
+	req.URL = streamURLArg
+	req.Body = ""
+	for name := range req.Header {
+		if strings.HasPrefix(name, "Content-") {
+			req.Header.Del(name)
+		}
+	}
+	req.Header.Set("Accept", "text/event-stream, */*")
+	req.Header.Set("Cache-Control", "no-cache")
+	return req
+}
+
+func startStream(ctx context.Context, run *Run, req Request) {
+	if streamURLArg == "" {
+		return
+	}
+	streamCtx, cancel := context.WithCancel(ctx)
+	monitor := &StreamMonitor{
+		dir:     run.dir,
+		logFile: Must2(os.OpenFile(filepath.Join(run.dir, "stream.log"), os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0644)),
+		result:  StreamResult{URL: redact(streamURLArg), Connections: make([]StreamConnection, 0)},
+		cancel:  cancel,
+		done:    make(chan struct{}),
+	}
+	run.stream = monitor
+	go monitor.run(streamCtx, streamRequest(req))
+}
+
+func (m *StreamMonitor) log(format string, args ...any) {
+	now := time.Now()
+	event := redact(fmt.Sprintf(format, args...))
+	Must2(fmt.Fprintf(m.logFile, "%v %s\n", formatTime(now), event))
+	if dashboard == nil {
+		cfmt.Fprintf(console, "%v #bB{stream} %s\n", formatTime(now), event)
+	}
+}
+
+func (m *StreamMonitor) run(ctx context.Context, req Request) {
+	defer close(m.done)
+	for ctx.Err() == nil {
+		connection, authenticated := m.connect(ctx, req)
+		m.mu.Lock()
+		m.result.Connections = append(m.result.Connections, connection)
+		m.result.Verdict = m.verdict()
+		writeJSON(filepath.Join(m.dir, "stream.json"), m.result)
+		m.mu.Unlock()
+		if !authenticated {
+			return
+		}
+		if connection.Lifetime < streamRetryDelay {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(streamRetryDelay):
+			}
+		}
+	}
+}
+
+func (m *StreamMonitor) connect(ctx context.Context, req Request) (connection StreamConnection, authenticated bool) {
+	connection.Opened = time.Now()
+	defer func() {
+		connection.Lifetime = time.Since(connection.Opened).Round(time.Millisecond)
+		m.log("connection ended after %v: %s", connection.Lifetime, connection.Termination)
+	}()
+	client := newHTTPClient(req)
+	client.Timeout = 0
+	httpReq, err := http.NewRequestWithContext(ctx, req.Method, req.URL, nil)
+	if err != nil {
+		connection.Termination = err.Error()
+		return connection, false
+	}
+	httpReq.Header = req.Header.Clone()
+	if host := req.Header.Get("Host"); host != "" {
+		httpReq.Host = host
+	}
+	httpResp, err := client.Do(httpReq)
+	if err != nil {
+		connection.Termination = m.termination(ctx, err)
+		return connection, true
+	}
+	defer httpResp.Body.Close()
+	connection.Status = httpResp.StatusCode
+	if httpResp.StatusCode >= 300 {
+		connection.Termination = "rejected with " + httpResp.Status
+		if location := httpResp.Header.Get("Location"); location != "" {
+			connection.Termination += " to " + location
+		}
+		return connection, false
+	}
+	// An expired session is often answered with 200 and a login page, so a
+	// response only counts as authenticated with the content type of the
+	// first accepted one.
+	contentType, _, _ := mime.ParseMediaType(httpResp.Header.Get("Content-Type"))
+	m.mu.Lock()
+	if m.result.Mode == "" {
+		m.result.Mode = streamLongPoll
+		if contentType == "text/event-stream" {
+			m.result.Mode = streamSSE
+		}
+		m.result.ContentType = contentType
+		m.log("%s connection opened (%s, %s)", m.result.Mode, httpResp.Status, cmp.Or(contentType, "no content type"))
+	}
+	mode, expected := m.result.Mode, m.result.ContentType
+	m.mu.Unlock()
+	if contentType != expected {
+		connection.Termination = fmt.Sprintf("rejected with %s (%s instead of %s)", httpResp.Status, cmp.Or(contentType, "no content type"), cmp.Or(expected, "no content type"))
+		return connection, false
+	}
+	if mode == streamLongPoll {
+		body, err := io.ReadAll(httpResp.Body)
+		if err != nil {
+			connection.Termination = m.termination(ctx, err)
+			return connection, true
+		}
+		if len(body) > 0 {
+			connection.Events++
+			m.log("poll returned %s with %d bytes: %s", httpResp.Status, len(body), abbreviate(string(body)))
+		}
+		connection.Termination = "poll completed"
+		return connection, true
+	}
+	reader := bufio.NewReader(httpResp.Body)
+	name, data := "", make([]string, 0)
+	for {
+		line, err := reader.ReadString('\n')
+		line = strings.TrimRight(line, "\r\n")
+		switch {
+		case err != nil:
+			connection.Termination = m.termination(ctx, err)
+			return connection, true
+		case strings.HasPrefix(line, ":"):
+			connection.Heartbeats++
+			m.log("heartbeat %s", abbreviate(line))
+		case line == "":
+			if name != "" || len(data) > 0 {
+				connection.Events++
+				m.log("event %s: %s", cmp.Or(name, "message"), abbreviate(strings.Join(data, "\n")))
+			}
+			name, data = "", data[:0]
+		case strings.HasPrefix(line, "event:"):
+			name = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+}
+
+func (m *StreamMonitor) termination(ctx context.Context, err error) string {
+	switch {
+	case ctx.Err() != nil:
+		return "closed at the end of the test"
+	case err == io.EOF:
+		return "closed by the server"
+	default:
+		return "connection error: " + err.Error()
+	}
+}
+
+func (m *StreamMonitor) verdict() string {
+	mode := cmp.Or(m.result.Mode, "stream")
+	longest := time.Duration(0)
+	for _, connection := range m.result.Connections {
+		longest = max(longest, connection.Lifetime)
+	}
+	last := m.result.Connections[len(m.result.Connections)-1]
+	if strings.HasPrefix(last.Termination, "rejected") {
+		return fmt.Sprintf("Stream (%s): %s %v after the start, longest connection lasted %v", mode, last.Termination, last.Opened.Sub(startTime).Round(time.Second), longest)
+	}
+	connections := fmt.Sprintf("%d connections", len(m.result.Connections))
+	if len(m.result.Connections) == 1 {
+		connections = "1 connection"
+	}
+	return fmt.Sprintf("Stream (%s): %s, longest lasted %v, last one %s", mode, connections, longest, last.Termination)
+}
+
+func (m *StreamMonitor) Stop() StreamResult {
+	m.cancel()
+	<-m.done
+	m.logFile.Close()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.result
+}
+
+func abbreviate(s string) string {
+	s = strings.ReplaceAll(s, "\n", " ")
+	if len(s) > maxStreamEventLog {
+		return s[:maxStreamEventLog] + "..."
+	}
+	return s
+}
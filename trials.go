@@ -0,0 +1,372 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/cmplx"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/tobiashort/cfmt-go"
+	. "github.com/tobiashort/utils-go/must"
+)
+
+const minSweepAlignment = 0.95
+
+// Two-sided 95% quantiles of Student's t-distribution for 1 to 30 degrees of freedom.
+var tQuantiles95 = []float64{
+	12.706, 4.303, 3.182, 2.776, 2.571, 2.447, 2.365, 2.306, 2.262, 2.228,
+	2.201, 2.179, 2.160, 2.145, 2.131, 2.120, 2.110, 2.101, 2.093, 2.086,
+	2.080, 2.074, 2.069, 2.064, 2.060, 2.056, 2.052, 2.048, 2.045, 2.042,
+}
+
+type TrialResult struct {
+	Index    int            `json:"index"`
+	Dir      string         `json:"dir"`
+	Verdict  string         `json:"verdict"`
+	Lower    time.Duration  `json:"lower,omitempty"`
+	Upper    time.Duration  `json:"upper,omitempty"`
+	LoggedAt *time.Time     `json:"logged_out_at,omitempty"`
+	Window   time.Duration  `json:"window,omitempty"`
+	Observed bool           `json:"observed"`
+	Error    string         `json:"error,omitempty"`
+	Estimate *time.Duration `json:"estimate,omitempty"`
+}
+
+type TrialStats struct {
+	Observed     int           `json:"observed"`
+	Min          time.Duration `json:"min"`
+	Median       time.Duration `json:"median"`
+	Max          time.Duration `json:"max"`
+	Mean         time.Duration `json:"mean"`
+	CILower      time.Duration `json:"ci95_lower"`
+	CIUpper      time.Duration `json:"ci95_upper"`
+	SweepPeriod  time.Duration `json:"sweep_period,omitempty"`
+	SweepVerdict string        `json:"sweep"`
+}
+
+var (
+	trialsArg         int
+	loginRequest      Request
+	loginTokenPattern *regexp.Regexp
+)
+
+func configureTrials(args Args) error {
+	trialsArg = args.Trials
+	if args.Trials < 1 {
+		return fmt.Errorf("--trials must be at least 1")
+	}
+	if args.Login == "" {
+		if args.Trials > 1 {
+			return fmt.Errorf("--trials requires --login to get a fresh session between trials")
+		}
+		return nil
+	}
+	var err error
+	loginRequest, err = readCommandFile(args.Login)
+	if err != nil {
+		return err
+	}
+	addRequestSecrets(loginRequest)
+	if args.LoginToken != "" {
+		loginTokenPattern, err = regexp.Compile(args.LoginToken)
+		if err != nil {
+			return fmt.Errorf("invalid --login-token pattern: %w", err)
+		}
+		if loginTokenPattern.NumSubexp() < 1 {
+			return fmt.Errorf("--login-token pattern needs a group that captures the token")
+		}
+	}
+	return nil
+}
+
+func mergeCookies(header string, cookies []*http.Cookie) string {
+	pairs := make([]string, 0)
+	for _, pair := range strings.Split(header, ";") {
+		pair = strings.TrimSpace(pair)
+		name, _, _ := strings.Cut(pair, "=")
+		replaced := slices.ContainsFunc(cookies, func(cookie *http.Cookie) bool { return cookie.Name == name })
+		if pair != "" && !replaced {
+			pairs = append(pairs, pair)
+		}
+	}
+	for _, cookie := range cookies {
+		if cookie.MaxAge >= 0 && cookie.Value != "" {
+			pairs = append(pairs, cookie.Name+"="+cookie.Value)
+		}
+	}
+	return strings.Join(pairs, "; ")
+}
+
+func relogin(ctx context.Context, req Request) (Request, error) {
+	req, err := loginSession(ctx, loginRequest, req)
+	if err != nil {
+		return Request{}, err
+	}
+	check, err := sendRequest(ctx, req)
+	if err != nil {
+		return Request{}, fmt.Errorf("request after login failed: %s", redact(err.Error()))
+	}
+	if similarity := similarityTo(referenceResponse, check); verdictFor(similarity) != verdictAuthenticated {
+		return Request{}, fmt.Errorf("not authenticated after login (%f similarity)", similarity)
+	}
+	return req, nil
+}
+
+// loginJar remembers the names of all cookies set along the redirect chain
+// of a login, e.g. the session cookie of a POST answered with 302.
+type loginJar struct {
+	http.CookieJar
+	names map[string]bool
+}
+
+func (jar *loginJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	for _, cookie := range cookies {
+		jar.names[cookie.Name] = true
+	}
+	jar.CookieJar.SetCookies(u, cookies)
+}
+
+// sendLogin sends the login request and returns the cookies set anywhere
+// along its redirect chain that apply to the target URL.
+func sendLogin(ctx context.Context, login Request, target string) (Response, []*http.Cookie, error) {
+	jar := &loginJar{CookieJar: Must2(cookiejar.New(nil)), names: make(map[string]bool)}
+	if u, err := url.Parse(login.URL); err == nil {
+		cookies, _ := http.ParseCookie(login.Header.Get("Cookie"))
+		for _, cookie := range cookies {
+			cookie.Path = "/"
+		}
+		jar.CookieJar.SetCookies(u, cookies)
+	}
+	client := newHTTPClient(login)
+	client.Jar = jar
+	resp, err := sendRequestWith(ctx, client, login)
+	if err != nil {
+		return resp, nil, err
+	}
+	cookies := make([]*http.Cookie, 0)
+	if u, err := url.Parse(target); err == nil {
+		for _, cookie := range jar.Cookies(u) {
+			if jar.names[cookie.Name] && cookie.Value != "" {
+				cookies = append(cookies, cookie)
+			}
+		}
+	}
+	return resp, cookies, nil
+}
+
+func loginSession(ctx context.Context, login Request, req Request) (Request, error) {
+	resp, cookies, err := sendLogin(ctx, login, req.URL)
+	if err != nil {
+		return Request{}, fmt.Errorf("login failed: %s", redact(err.Error()))
+	}
+	req = req.Clone()
+	if len(cookies) > 0 {
+		req.Header.Set("Cookie", mergeCookies(req.Header.Get("Cookie"), cookies))
+	}
+	if loginTokenPattern != nil {
+		match := loginTokenPattern.FindStringSubmatch(formatHeaders(resp) + "\n" + resp.Body)
+		if match == nil {
+			return Request{}, fmt.Errorf("login response (%s) contains no token matching --login-token", resp.Status)
+		}
+		req.Header.Set("Authorization", "Bearer "+match[1])
+	} else if len(cookies) == 0 {
+		return Request{}, fmt.Errorf("login response (%s) sets no cookies", resp.Status)
+	}
+	addRequestSecrets(req)
+	return req, nil
+}
+
+func trialResult(index int, dir string, run *Run) TrialResult {
+	trial := TrialResult{Index: index, Dir: filepath.Base(dir), Verdict: run.state.Verdict}
+	lastAuthenticated, loggedOut := logoutWindow(run.state.Probes)
+	if lastAuthenticated == nil || loggedOut == nil {
+		return trial
+	}
+	typeOfTest := run.state.Test
+	trial.Observed = true
+	trial.Lower = measure(typeOfTest, *lastAuthenticated)
+	trial.Upper = measure(typeOfTest, *loggedOut)
+	estimate := (trial.Lower + trial.Upper) / 2
+	trial.Estimate = &estimate
+	at := lastAuthenticated.Time.Add(loggedOut.Time.Sub(lastAuthenticated.Time) / 2)
+	trial.Window = loggedOut.Time.Sub(lastAuthenticated.Time)
+	if typeOfTest == inactivityTimeoutTest {
+		// The logged out probe waited the whole upper interval, but the
+		// session expired between the lower and the upper idle time.
+		at = lastAuthenticated.Time.Add(estimate)
+		trial.Window = trial.Upper - trial.Lower
+	}
+	trial.LoggedAt = &at
+	return trial
+}
+
+func median(values []time.Duration) time.Duration {
+	sorted := slices.Clone(values)
+	slices.Sort(sorted)
+	n := len(sorted)
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
+
+func sweepAlignment(times []time.Time, period time.Duration) float64 {
+	var sum complex128
+	for _, t := range times {
+		phase := 2 * math.Pi * float64(t.UnixNano()%int64(period)) / float64(period)
+		sum += cmplx.Exp(complex(0, phase))
+	}
+	return cmplx.Abs(sum) / float64(len(times))
+}
+
+// A cleanup job that runs every P expires sessions on a fixed wall-clock grid,
+// so the observed timeouts spread over up to P while the logout moments line up
+// modulo P. Report the smallest period at least as large as the spread for
+// which the logout moments align.
+func detectSweep(trials []TrialResult, estimates []time.Duration) (time.Duration, string) {
+	if len(estimates) < 3 {
+		return 0, "unknown (needs at least 3 observed logouts)"
+	}
+	resolution := time.Duration(0)
+	times := make([]time.Time, 0, len(trials))
+	for _, trial := range trials {
+		if trial.Observed {
+			resolution = max(resolution, trial.Window)
+			times = append(times, *trial.LoggedAt)
+		}
+	}
+	spread := slices.Max(estimates) - slices.Min(estimates)
+	if spread <= 2*resolution {
+		return 0, "unlikely (timeouts are consistent within the probe resolution)"
+	}
+	from := max(spread, 10*resolution)
+	if from > slices.Max(estimates) {
+		return 0, "unknown (probe interval too coarse to detect a sweep)"
+	}
+	step := max(resolution/10, 100*time.Millisecond)
+	for period := from; period <= slices.Max(estimates); period += step {
+		if sweepAlignment(times, period) >= minSweepAlignment {
+			return period, fmt.Sprintf("likely, sessions expire on a grid of about %v", period.Round(time.Second))
+		}
+	}
+	return 0, "unlikely (logout moments do not align to a common period)"
+}
+
+func trialStats(trials []TrialResult) TrialStats {
+	estimates := make([]time.Duration, 0, len(trials))
+	for _, trial := range trials {
+		if trial.Observed {
+			estimates = append(estimates, *trial.Estimate)
+		}
+	}
+	stats := TrialStats{Observed: len(estimates), SweepVerdict: "unknown (no logout observed)"}
+	if len(estimates) == 0 {
+		return stats
+	}
+	stats.Min = slices.Min(estimates)
+	stats.Max = slices.Max(estimates)
+	stats.Median = median(estimates)
+	sum := 0.0
+	for _, estimate := range estimates {
+		sum += float64(estimate)
+	}
+	mean := sum / float64(len(estimates))
+	stats.Mean = time.Duration(mean)
+	stats.CILower, stats.CIUpper = stats.Mean, stats.Mean
+	if n := len(estimates); n > 1 {
+		variance := 0.0
+		for _, estimate := range estimates {
+			variance += (float64(estimate) - mean) * (float64(estimate) - mean)
+		}
+		variance /= float64(n - 1)
+		t := 1.96
+		if n-1 <= len(tQuantiles95) {
+			t = tQuantiles95[n-2]
+		}
+		margin := time.Duration(t * math.Sqrt(variance/float64(n)))
+		stats.CILower, stats.CIUpper = max(stats.Mean-margin, 0), stats.Mean+margin
+	}
+	stats.SweepPeriod, stats.SweepVerdict = detectSweep(trials, estimates)
+	return stats
+}
+
+func formatTrialsReport(typeOfTest string, trials []TrialResult, stats TrialStats) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# wylmo trials report\n\n")
+	fmt.Fprintf(&b, "- Test: %s\n", typeOfTest)
+	fmt.Fprintf(&b, "- Trials: %d, %d with an observed logout\n", len(trials), stats.Observed)
+	if stats.Observed > 0 {
+		fmt.Fprintf(&b, "- Timeout: min %v, median %v, max %v\n", stats.Min.Round(time.Second), stats.Median.Round(time.Second), stats.Max.Round(time.Second))
+		fmt.Fprintf(&b, "- Mean: %v, 95%% confidence interval %v to %v\n", stats.Mean.Round(time.Second), stats.CILower.Round(time.Second), stats.CIUpper.Round(time.Second))
+	}
+	fmt.Fprintf(&b, "- Periodic sweep: %s\n\n", stats.SweepVerdict)
+	fmt.Fprintf(&b, "| Trial | Directory | Logged out between | Estimate | Verdict |\n")
+	fmt.Fprintf(&b, "|---|---|---|---|---|\n")
+	for _, trial := range trials {
+		window, estimate := "-", "-"
+		if trial.Observed {
+			window = fmt.Sprintf("%v and %v", trial.Lower, trial.Upper)
+			estimate = trial.Estimate.Round(time.Second).String()
+		}
+		verdict := trial.Verdict
+		if trial.Error != "" {
+			verdict = trial.Error
+		}
+		fmt.Fprintf(&b, "| %d | %s | %s | %s | %s |\n", trial.Index, trial.Dir, window, estimate, strings.ReplaceAll(verdict, "|", "\\|"))
+	}
+	return b.String()
+}
+
+func saveTrials(dir string, typeOfTest string, trials []TrialResult) TrialStats {
+	stats := trialStats(trials)
+	writeJSON(filepath.Join(dir, "trials.json"), map[string]any{
+		"test":   typeOfTest,
+		"trials": trials,
+		"stats":  stats,
+	})
+	Must(os.WriteFile(filepath.Join(dir, "report.md"), []byte(formatTrialsReport(typeOfTest, trials, stats)), 0644))
+	return stats
+}
+
+func performTrials(ctx context.Context, typeOfTest string, dir string, curlCommand string, req Request) {
+	trials := make([]TrialResult, 0, trialsArg)
+	for i := 1; i <= trialsArg && ctx.Err() == nil; i++ {
+		trialDir := filepath.Join(dir, fmt.Sprintf("trial-%02d", i))
+		Must(os.Mkdir(trialDir, 0755))
+		cfmt.Fprintf(console, "Starting trial #yB{%d/%d}\n", i, trialsArg)
+		if i > 1 {
+			var err error
+			req, err = relogin(ctx, req)
+			if err != nil {
+				if ctx.Err() != nil {
+					break
+				}
+				cfmt.Fprintf(console, "#r{Trial %d: %s}\n", i, err.Error())
+				trials = append(trials, TrialResult{Index: i, Dir: filepath.Base(trialDir), Error: err.Error()})
+				saveTrials(dir, typeOfTest, trials)
+				notify(eventError, typeOfTest, dir, fmt.Sprintf("Trial %d: %s", i, err.Error()), "")
+				break
+			}
+			curlCommand = req.CurlCommand()
+		}
+		run := performSingleTest(ctx, typeOfTest, trialDir, curlCommand, req)
+		trials = append(trials, trialResult(i, trialDir, run))
+		saveTrials(dir, typeOfTest, trials)
+	}
+	stats := saveTrials(dir, typeOfTest, trials)
+	cfmt.Fprintf(console, "Trials: #yB{%d} of #yB{%d} observed a logout\n", stats.Observed, len(trials))
+	if stats.Observed > 0 {
+		cfmt.Fprintf(console, "Timeout: min #yB{%v}, median #yB{%v}, max #yB{%v}\n", stats.Min.Round(time.Second), stats.Median.Round(time.Second), stats.Max.Round(time.Second))
+		cfmt.Fprintf(console, "Mean: #yB{%v}, 95%% confidence interval #yB{%v} to #yB{%v}\n", stats.Mean.Round(time.Second), stats.CILower.Round(time.Second), stats.CIUpper.Round(time.Second))
+	}
+	cfmt.Fprintf(console, "Periodic sweep: #yB{%s}\n", stats.SweepVerdict)
+}
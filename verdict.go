@@ -0,0 +1,61 @@
+package main
+
+import (
+	"math"
+	"time"
+
+	"github.com/tobiashort/cfmt-go"
+
+	. "github.com/tobiashort/cosine-similarity-go"
+)
+
+const (
+	verdictAuthenticated = "authenticated"
+	verdictLoggedOut     = "logged out"
+	verdictInconclusive  = "inconclusive"
+)
+
+type ProbeResult struct {
+	Index      int           `json:"index"`
+	Time       time.Time     `json:"time"`
+	Elapsed    time.Duration `json:"elapsed"`
+	Waited     time.Duration `json:"waited,omitempty"`
+	Status     int           `json:"status,omitempty"`
+	Similarity float64       `json:"similarity"`
+	Verdict    string        `json:"verdict"`
+	Error      string        `json:"error,omitempty"`
+	Redirects  []Redirect    `json:"redirects,omitempty"`
+	SHA256     string        `json:"sha256"`
+}
+
+// similarityTo compares the bodies, like wylmo compared the curl output. Only
+// responses without any body, e.g. to HEAD requests, fall back to the status.
+func similarityTo(reference Response, resp Response) float64 {
+	a, b := reference.Body, resp.Body
+	if a == "" && b == "" {
+		a, b = reference.Status, resp.Status
+	}
+	similarity := CosineSimilarity(a, b)
+	if math.IsNaN(similarity) {
+		return 0
+	}
+	return similarity
+}
+
+func verdictFor(similarity float64) string {
+	if similarity >= thresholdArg {
+		return verdictAuthenticated
+	}
+	return verdictLoggedOut
+}
+
+func colorByVerdict(verdict string, s string) string {
+	switch verdict {
+	case verdictAuthenticated:
+		return cfmt.Sprintf("#g{%s}", s)
+	case verdictLoggedOut:
+		return cfmt.Sprintf("#r{%s}", s)
+	default:
+		return cfmt.Sprintf("#y{%s}", s)
+	}
+}
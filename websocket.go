@@ -0,0 +1,433 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tobiashort/cfmt-go"
+	. "github.com/tobiashort/utils-go/must"
+)
+
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC11B85"
+
+const maxWebSocketMessage = 16 << 20
+
+const (
+	wsContinuation = 0x0
+	wsText         = 0x1
+	wsBinary       = 0x2
+	wsClose        = 0x8
+	wsPing         = 0x9
+	wsPong         = 0xA
+)
+
+// WebSocket is a minimal RFC 6455 client: unfragmented masked writes,
+// reassembly of fragmented reads and automatic answers to pings.
+type WebSocket struct {
+	conn io.ReadWriteCloser
+	br   *bufio.Reader
+	mu   sync.Mutex
+}
+
+type WebSocketMessage struct {
+	Opcode byte
+	Data   []byte
+}
+
+func websocketURL(target string) (string, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return "", err
+	}
+	switch u.Scheme {
+	case "ws":
+		u.Scheme = "http"
+	case "wss":
+		u.Scheme = "https"
+	case "http", "https":
+	default:
+		return "", fmt.Errorf("unsupported WebSocket scheme: %s", u.Scheme)
+	}
+	return u.String(), nil
+}
+
+func websocketAccept(key string) string {
+	sum := sha1.Sum([]byte(key + websocketGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func dialWebSocket(ctx context.Context, target string, req Request) (*WebSocket, Response, error) {
+	httpURL, err := websocketURL(target)
+	if err != nil {
+		return nil, Response{}, err
+	}
+	nonce := make([]byte, 16)
+	Must2(rand.Read(nonce))
+	key := base64.StdEncoding.EncodeToString(nonce)
+
+	upgrade := req.Clone()
+	upgrade.Method = http.MethodGet
+	upgrade.URL = httpURL
+	upgrade.Body = ""
+	for name := range upgrade.Header {
+		if strings.HasPrefix(name, "Content-") || (strings.HasPrefix(name, "Sec-Websocket-") && name != "Sec-Websocket-Protocol") {
+			upgrade.Header.Del(name)
+		}
+	}
+	upgrade.Header.Set("Connection", "Upgrade")
+	upgrade.Header.Set("Upgrade", "websocket")
+	upgrade.Header.Set("Sec-WebSocket-Version", "13")
+	upgrade.Header.Set("Sec-WebSocket-Key", key)
+
+	client := newHTTPClient(upgrade)
+	client.Timeout = 0
+	client.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	transport := client.Transport.(*http.Transport)
+	transport.ForceAttemptHTTP2 = false
+	transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	transport.ResponseHeaderTimeout = 60 * time.Second
+
+	httpReq, err := http.NewRequestWithContext(ctx, upgrade.Method, upgrade.URL, nil)
+	if err != nil {
+		return nil, Response{}, err
+	}
+	httpReq.Header = upgrade.Header.Clone()
+	if host := upgrade.Header.Get("Host"); host != "" {
+		httpReq.Host = host
+	}
+	httpResp, err := client.Do(httpReq)
+	if err != nil {
+		return nil, Response{}, err
+	}
+	resp := Response{
+		Status:     httpResp.Proto + " " + httpResp.Status,
+		StatusCode: httpResp.StatusCode,
+		Header:     httpResp.Header,
+	}
+	if httpResp.StatusCode != http.StatusSwitchingProtocols {
+		body, _ := io.ReadAll(io.LimitReader(httpResp.Body, maxWebSocketMessage))
+		httpResp.Body.Close()
+		resp.Body = string(body)
+		return nil, resp, fmt.Errorf("WebSocket handshake returned %s", httpResp.Status)
+	}
+	conn, ok := httpResp.Body.(io.ReadWriteCloser)
+	if !ok {
+		httpResp.Body.Close()
+		return nil, resp, fmt.Errorf("WebSocket connection is not writable")
+	}
+	if httpResp.Header.Get("Sec-WebSocket-Accept") != websocketAccept(key) {
+		conn.Close()
+		return nil, resp, fmt.Errorf("WebSocket handshake returned an invalid Sec-WebSocket-Accept")
+	}
+	return &WebSocket{conn: conn, br: bufio.NewReader(conn)}, resp, nil
+}
+
+func (ws *WebSocket) writeFrame(opcode byte, payload []byte) error {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	frame := []byte{0x80 | opcode}
+	switch {
+	case len(payload) < 126:
+		frame = append(frame, 0x80|byte(len(payload)))
+	case len(payload) <= 0xFFFF:
+		frame = append(frame, 0x80|126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(len(payload)))
+	default:
+		frame = append(frame, 0x80|127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(len(payload)))
+	}
+	mask := make([]byte, 4)
+	Must2(rand.Read(mask))
+	frame = append(frame, mask...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	_, err := ws.conn.Write(frame)
+	return err
+}
+
+func (ws *WebSocket) readFrame() (bool, byte, []byte, error) {
+	var head [2]byte
+	if _, err := io.ReadFull(ws.br, head[:]); err != nil {
+		return false, 0, nil, err
+	}
+	fin := head[0]&0x80 != 0
+	opcode := head[0] & 0x0F
+	length := uint64(head[1] & 0x7F)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(ws.br, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(ws.br, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	if length > maxWebSocketMessage {
+		return false, 0, nil, fmt.Errorf("WebSocket frame of %d bytes is too large", length)
+	}
+	var mask [4]byte
+	masked := head[1]&0x80 != 0
+	if masked {
+		if _, err := io.ReadFull(ws.br, mask[:]); err != nil {
+			return false, 0, nil, err
+		}
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(ws.br, payload); err != nil {
+		return false, 0, nil, err
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+	return fin, opcode, payload, nil
+}
+
+// Read returns the next text, binary or close message. Pings are answered
+// and pongs are skipped.
+func (ws *WebSocket) Read() (WebSocketMessage, error) {
+	var message WebSocketMessage
+	for {
+		fin, opcode, payload, err := ws.readFrame()
+		if err != nil {
+			return message, err
+		}
+		switch opcode {
+		case wsPing:
+			if err := ws.writeFrame(wsPong, payload); err != nil {
+				return message, err
+			}
+			continue
+		case wsPong:
+			continue
+		case wsClose:
+			ws.writeFrame(wsClose, payload)
+			return WebSocketMessage{Opcode: wsClose, Data: payload}, nil
+		case wsContinuation:
+			if message.Opcode == 0 {
+				return message, fmt.Errorf("unexpected WebSocket continuation frame")
+			}
+		case wsText, wsBinary:
+			message.Opcode = opcode
+		default:
+			return message, fmt.Errorf("unknown WebSocket opcode %#x", opcode)
+		}
+		message.Data = append(message.Data, payload...)
+		if len(message.Data) > maxWebSocketMessage {
+			return message, fmt.Errorf("WebSocket message is too large")
+		}
+		if fin {
+			return message, nil
+		}
+	}
+}
+
+func (ws *WebSocket) Send(text string) error {
+	return ws.writeFrame(wsText, []byte(text))
+}
+
+func (ws *WebSocket) Close() error {
+	ws.writeFrame(wsClose, binary.BigEndian.AppendUint16(nil, 1000))
+	return ws.conn.Close()
+}
+
+func closeStatus(data []byte) string {
+	if len(data) < 2 {
+		return "without a status code"
+	}
+	status := fmt.Sprintf("with code %d", binary.BigEndian.Uint16(data))
+	if len(data) > 2 {
+		status += fmt.Sprintf(" (%s)", string(data[2:]))
+	}
+	return status
+}
+
+const maxLoggedWebSocketMessages = 100
+
+var (
+	wsURLArg           string
+	wsMessageArg       string
+	wsLoggedOutPattern *regexp.Regexp
+)
+
+type webSocketEvent struct {
+	message WebSocketMessage
+	err     error
+}
+
+func configureWebSocket(args Args) error {
+	wsURLArg = args.WsUrl
+	wsMessageArg = args.WsMessage
+	if args.WsLoggedOut != "" {
+		re, err := regexp.Compile(args.WsLoggedOut)
+		if err != nil {
+			return fmt.Errorf("invalid --ws-logged-out pattern: %w", err)
+		}
+		wsLoggedOutPattern = re
+	}
+	return nil
+}
+
+func webSocketTarget(req Request) string {
+	if wsURLArg != "" {
+		return wsURLArg
+	}
+	u, err := url.Parse(req.URL)
+	if err != nil {
+		return req.URL
+	}
+	u.Scheme = strings.Replace(u.Scheme, "http", "ws", 1)
+	return u.String()
+}
+
+func recordHandshake(run *Run, resp Response, err error) {
+	now := time.Now()
+	result := ProbeResult{Time: now, Elapsed: now.Sub(startTime), Status: resp.StatusCode, Verdict: verdictAuthenticated, Similarity: 1}
+	switch {
+	case err == nil:
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		result.Verdict = verdictLoggedOut
+		result.Similarity = 0
+	default:
+		result.Verdict = verdictInconclusive
+		result.Similarity = 0
+		result.Error = redact(err.Error())
+	}
+	run.Record(result, resp)
+}
+
+func performWebSocketTest(ctx context.Context, dir string, curlCommand string, req Request) *Run {
+	cfmt.Printf("Performing #yB{'%s'} test...\n", webSocketTest)
+	interval := hardTimeoutInterval()
+	if wsMessageArg != "" {
+		cfmt.Printf("Message is sent every #yB{'%v'}\n", interval)
+	} else {
+		cfmt.Printf("Connection is kept idle\n")
+	}
+	startTime = time.Now()
+	run := startFindingSession(dir, webSocketTest, curlCommand, req)
+	defer run.Finish(ctx)
+
+	target := webSocketTarget(req)
+	ws, resp, err := dialWebSocket(ctx, target, req)
+	recordHandshake(run, resp, err)
+	if err != nil {
+		run.Conclude(findingInconclusive, "WebSocket handshake with %s failed: %s", target, err.Error())
+		return run
+	}
+	defer ws.Close()
+	run.Note("WebSocket connection to %s is open", target)
+
+	events := make(chan webSocketEvent)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			message, err := ws.Read()
+			select {
+			case events <- webSocketEvent{message, err}:
+			case <-done:
+				return
+			}
+			if err != nil || message.Opcode == wsClose {
+				return
+			}
+		}
+	}()
+	send := func() {
+		if err := ws.Send(wsMessageArg); err != nil {
+			run.Note("Sending the message failed: %s", err.Error())
+		}
+	}
+	var ticks <-chan time.Time
+	mode := "while idle"
+	if wsMessageArg != "" {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		ticks = ticker.C
+		mode = fmt.Sprintf("while sending a message every %v", interval)
+		send()
+	}
+
+	var reference Response
+	var lastAuthenticated time.Duration
+	messages := 0
+	lastVerdict := ""
+	since := func() string {
+		if messages == 0 {
+			return ""
+		}
+		if wsLoggedOutPattern == nil {
+			return fmt.Sprintf(", %d messages received, the last one after %v", messages, lastAuthenticated.Round(time.Second))
+		}
+		return fmt.Sprintf(", %d messages received, the last authenticated one after %v", messages, lastAuthenticated.Round(time.Second))
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return run
+		case <-ticks:
+			send()
+		case event := <-events:
+			elapsed := time.Since(startTime).Round(time.Second)
+			if event.err != nil {
+				run.Conclude(findingInfo, "connection dropped %v after the start %s without a close frame: %s%s", elapsed, mode, event.err.Error(), since())
+				return run
+			}
+			if event.message.Opcode == wsClose {
+				run.Conclude(findingInfo, "server closed the connection %v after the start %s, %s%s", elapsed, mode, closeStatus(event.message.Data), since())
+				return run
+			}
+			resp := Response{Status: "WebSocket message", Body: string(event.message.Data)}
+			if reference.Status == "" {
+				reference = resp
+			}
+			now := time.Now()
+			// Servers push different message types, so without --ws-logged-out
+			// messages are only recorded and the connection state decides.
+			result := ProbeResult{Time: now, Elapsed: now.Sub(startTime), Similarity: similarityTo(reference, resp), Verdict: verdictInconclusive}
+			if wsLoggedOutPattern != nil {
+				result.Verdict = verdictAuthenticated
+				if wsLoggedOutPattern.MatchString(resp.Body) {
+					result.Verdict = verdictLoggedOut
+				}
+			}
+			messages++
+			// Only the first message and verdict changes become probes, the
+			// rest is sampled into the log to keep long pushing sockets cheap.
+			if result.Verdict != lastVerdict {
+				run.Record(result, resp)
+				lastVerdict = result.Verdict
+			} else if messages <= maxLoggedWebSocketMessages || messages%maxLoggedWebSocketMessages == 0 {
+				Must2(fmt.Fprintf(run.logFile, "%v message %d: %s\n", formatTime(now), messages, redact(abbreviate(resp.Body))))
+			}
+			if result.Verdict == verdictLoggedOut {
+				run.Conclude(findingInfo, "server answers with an unauthenticated message %v after the start %s%s", elapsed, mode, since())
+				return run
+			}
+			lastAuthenticated = result.Elapsed
+		}
+	}
+}